@@ -2,16 +2,23 @@ package main
 
 import (
     "flag"
+    "fmt"
+    "gob"
     "image"
     "image/png"
     _ "image/jpeg"
+    "json"
     "log"
     "os"
     "runtime"
+    "sivq"
+    "strconv"
+    "strings"
 )
 
 var (
     inputName   = flag.String("in", "", "input image")
+    channelList = flag.String("channels", "", "comma separated single channel images to use instead of -in")
     outputName  = flag.String("out", "", "output png")
     vectorX     = flag.Int("X", 272, "vector X location")
     vectorY     = flag.Int("Y", 274, "vector Y location")
@@ -19,33 +26,172 @@ var (
     vectorRings = flag.Int("R", 1, "vector rings")
     ringSizeInc = flag.Int("I", 2, "ring size increment")
     threshold   = flag.Float64("T", 0.0, "threshold for drawing")
+    autoThresh  = flag.String("autoThreshold", "manual", "threshold selection: manual (-T), otsu, percentile or triangle")
+    percentile  = flag.Float64("percentile", 0.05, "fraction of the best matching pixels drawn with -autoThreshold percentile")
     rotStride   = flag.Float64("K", 0.001, "rotation stride")
+    colorSpace  = flag.String("color", "rgb", "color space: rgb, gray, hsv, lab, od or he")
+    weights     = flag.String("weights", "", "comma separated channel weights")
+    samplerName = flag.String("sampler", "bresenham", "ring sampler: bresenham, bilinear or bicubic")
+    ringSamples = flag.Int("samples", 0, "samples per ring for bilinear and bicubic, 0 for one per pixel of the largest ring")
+    metricName  = flag.String("metric", "rms", "distance metric: rms, l1, ncc, cosine or rank")
+    exactRot    = flag.Bool("exact", false, "compare all rotations exactly, rms metric only (ignores rotation stride)")
+    mirror      = flag.Bool("mirror", false, "also match the mirror image of the vector")
+    mirrorName  = flag.String("mirrorOut", "", "output png showing where the best match was mirrored (white)")
+    scaleList   = flag.String("scales", "", "comma separated vector scales to search, e.g. 0.5,1,2")
+    scaleName   = flag.String("scaleOut", "", "output png of the best scale relative to the largest one")
+    orientName  = flag.String("orientationOut", "", "output png of the best rotation as hue and match strength as value")
+    vectorList  = flag.String("vectors", "", "comma separated saved vector files to match instead of -X and -Y")
+    labelName   = flag.String("labelOut", "", "output png of the best matching vector of -vectors")
+    topK        = flag.Int("top", 0, "also write the k best vectors per pixel as <labelOut>.top<rank>.png")
+    exampleList = flag.String("examples", "", "comma separated x:y or image:x:y locations to learn the vector from instead of -X and -Y")
+    saveName    = flag.String("saveVector", "", "save the vector into a file usable with -vectors")
+    truthName   = flag.String("truth", "", "ground truth mask png to evaluate the distance map against, white is positive")
+    truthPoints = flag.String("truthPoints", "", "comma separated x:y annotations to evaluate the distance map against instead of -truth")
+    pointRadius = flag.Int("pointRadius", 5, "radius of the positive area around every -truthPoints annotation")
+    evalName    = flag.String("evalOut", "", "output of the ROC and precision/recall curves, json if it ends with .json, csv otherwise")
+    posPoints   = flag.String("positives", "", "comma separated x:y points that should match, searches the vector parameters and strides with -negatives")
+    negPoints   = flag.String("negatives", "", "comma separated x:y points that should not match")
+    detectName  = flag.String("detectOut", "", "output of the matches below the threshold, json if it ends with .json, csv otherwise")
+    nmsRadius   = flag.Int("nms", 0, "radius within which only the best match is detected, 0 for the largest vector radius")
+    maskName    = flag.String("maskOut", "", "output png of the regions below the threshold, a color per region")
+    regionsName = flag.String("regionsOut", "", "output csv of the area, centroid, bounds and distances of every region")
+    openRadius  = flag.Int("open", 0, "radius of the morphological opening of the mask, 0 for none")
+    closeRadius = flag.Int("close", 0, "radius of the morphological closing of the mask, 0 for none")
+    fillHoles   = flag.Bool("fillHoles", false, "fill the holes of the mask regions")
+    minArea     = flag.Int("minArea", 1, "smallest region in pixels")
+    contourName = flag.String("contourOut", "", "output of the contours of the matches, svg over -in if it ends with .svg, GeoJSON otherwise")
+    simplify    = flag.Float64("simplify", 0.5, "largest distance in pixels of the simplified contours from the traced ones")
+    colormap    = flag.String("colormap", "", "render the output with a colormap: gray, viridis, magma or jet, transparent below the threshold")
+    valueRange  = flag.String("range", "", "comma separated match strengths drawn with the first and last color of -colormap, default 0,1")
+    overlay     = flag.Float64("overlay", 0.0, "opacity of the -colormap output blended over -in, 0 for the output alone")
+    roiList     = flag.String("roi", "", "comma separated x0:y0:x1:y1 rectangles, only the pixels inside are compared")
+    roiName     = flag.String("roiMask", "", "mask png, only the white pixels are compared")
+    tissue      = flag.Bool("tissue", false, "only compare the tissue of -in, detected against the white glass")
+    tissueClose = flag.Int("tissueClose", 5, "radius of the closing joining nearby pieces of detected tissue")
     matchStride = flag.Int("M", 1, "matching value stride (can be set to 3 for grayscale pictures)")
     matchOffset = flag.Int("O", 0, "matching offset")
     gammaAdj    = flag.Float64("g", 2.0, "gamma adjust")
     averageBias = flag.Float64("b", 0.0, "average bias")
+    workers     = flag.Int("P", 4, "number of worker threads")
+    chunkRows   = flag.Int("C", sivq.DefaultChunkRows, "rows a worker processes at a time")
+    borderMode  = flag.String("border", "skip", "border handling: skip, mirror, clamp or constant")
+    borderValue = flag.Float64("borderValue", 0.0, "value outside the image for constant border")
+    printStats  = flag.Bool("stats", false, "print distance map statistics")
 )
 
-func main() {
-    runtime.GOMAXPROCS(4)
+// loadImage decodes the image file name or exits.
+func loadImage(name string) image.Image {
+    input, err := os.OpenFile(name, os.O_RDONLY, 0666)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    defer input.Close()
+
+    m, _, err := image.Decode(input)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    return m
+}
+
+// loadVector decodes the saved vector file name or exits.
+func loadVector(name string) *sivq.RingVector {
+    input, err := os.OpenFile(name, os.O_RDONLY, 0666)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    defer input.Close()
+
+    var ringVector *sivq.RingVector
+    if err = gob.NewDecoder(input).Decode(&ringVector); err != nil {
+        log.Fatalln(err)
+    }
+    return ringVector
+}
+
+// parseExample parses an example location "x:y" or "image:x:y".
+func parseExample(s string) (name string, x int, y int) {
+    i := strings.LastIndex(s, ":")
+    if i < 0 {
+        log.Fatalln("invalid example " + s)
+    }
+    y, err := strconv.Atoi(s[i+1:])
+    if err != nil {
+        log.Fatalln(err)
+    }
+    s = s[:i]
+    if i = strings.LastIndex(s, ":"); i >= 0 {
+        name, s = s[:i], s[i+1:]
+    }
+    x, err = strconv.Atoi(s)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    return name, x, y
+}
+
+// learnVector learns a prototype from the examples sampled with load.
+func learnVector(p sivq.SIVQParameters, examples []string, load func(name string, x int, y int) *sivq.RingVector) *sivq.RingVector {
+    var samples []*sivq.RingVector
+    for _, example := range examples {
+        samples = append(samples, load(parseExample(example)))
+    }
+    prototype, err := sivq.LearnPrototype(p, samples)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    return prototype
+}
+
+// saveVector saves the last vector, the sampled or learned one, with
+// -saveVector.
+func saveVector(vectors []*sivq.RingVector) {
+    if *saveName == "" {
+        return
+    }
+    rv := vectors[len(vectors)-1]
+    if rv.Examples > 0 {
+        log.Printf("learned %s from %d examples\n", *saveName, rv.Examples)
+    }
+    output, err := os.OpenFile(*saveName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    defer output.Close()
+    if err = gob.NewEncoder(output).Encode(rv); err != nil {
+        log.Fatalln(err)
+    }
+}
 
+// savePNG encodes m into the file name or exits.
+func savePNG(name string, m image.Image) {
+    output, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    defer output.Close()
+
+    if err = png.Encode(output, m); err != nil {
+        log.Fatalln(err)
+    }
+}
+
+func main() {
     flag.Parse()
 
-    if *inputName == "" {
+    runtime.GOMAXPROCS(*workers)
+
+    if *inputName == "" && *channelList == "" {
         log.Fatalln("No input defined")
     }
     if *outputName == "" {
+        if *inputName == "" {
+            log.Fatalln("No output defined")
+        }
         *outputName = *inputName + ".heat.png"
         log.Println("No output defined. Using " + *outputName + " instead.")
     }
 
-    // open input file
-    input, err := os.OpenFile(*inputName, os.O_RDONLY, 0666)
-    if err != nil {
-        log.Fatalln(err)
-    }
-    defer input.Close()
-
     // create output file
     output, err := os.OpenFile(*outputName, os.O_CREATE|os.O_WRONLY, 0666)
     if err != nil {
@@ -53,32 +199,425 @@ func main() {
     }
     defer output.Close()
 
-    // decode png image
-    inputImage, _, err := image.Decode(input)
+    border, err := sivq.ParseBorderMode(*borderMode)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    thresholdMethod, err := sivq.ParseThresholdMethod(*autoThresh)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    metric, err := sivq.ParseMetric(*metricName)
     if err != nil {
         log.Fatalln(err)
     }
-    rgbaInput := rgba(inputImage)
+    if *exactRot && metric != sivq.RMS {
+        log.Fatalln("-exact is only supported with -metric rms")
+    }
+    if _, err = sivq.ParseColorSpace(*colorSpace); err != nil {
+        log.Fatalln(err)
+    }
+    channelWeights, err := sivq.ParseWeights(*weights)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    if _, err = sivq.ParseSampler(*samplerName, *ringSamples); err != nil {
+        log.Fatalln(err)
+    }
+    scales, err := sivq.ParseScales(*scaleList)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    heatmapColormap, err := sivq.ParseColormap(*colormap)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    low, high, err := sivq.ParseRange(*valueRange)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    if *overlay > 0 && *inputName == "" {
+        log.Fatalln("-overlay needs -in")
+    }
+
+    vectorParams := sivq.RingVectorParameters{
+        Radius:     *vectorSize,
+        Count:      *vectorRings,
+        RadiusInc:  *ringSizeInc,
+        ColorSpace: *colorSpace,
+        Weights:    channelWeights,
+        Sampler:    *samplerName,
+        Samples:    *ringSamples}
+
+    sivqParams := sivq.SIVQParameters{
+        GammaAdjustment:     sivq.Float(*gammaAdj),
+        AverageBias:         sivq.Float(*averageBias),
+        RotationStride:      sivq.Float(*rotStride),
+        ExactRotation:       *exactRot,
+        Mirror:              *mirror || *mirrorName != "",
+        Scales:              scales,
+        Orientation:         *orientName != "" || *detectName != "",
+        TopK:                *topK,
+        Metric:              metric,
+        MatchingStride:      *matchStride,
+        MatchingOffset:      *matchOffset,
+        Threshold:           sivq.Float(*threshold),
+        ThresholdMethod:     thresholdMethod,
+        ThresholdPercentile: sivq.Float(*percentile),
+        Workers:             *workers,
+        ChunkRows:           *chunkRows,
+        Border:              border,
+        BorderValue:         sivq.Float(*borderValue)}
+
+    // named vectors
+    vectorNames := strings.Fields(strings.Replace(*vectorList, ",", " ", -1))
+    var vectors []*sivq.RingVector
+    for _, name := range vectorNames {
+        vectors = append(vectors, loadVector(name))
+    }
+    examples := strings.Fields(strings.Replace(*exampleList, ",", " ", -1))
 
-    vectorParams := RingVectorParameters{
-        Radius:    *vectorSize,
-        Count:     *vectorRings,
-        RadiusInc: *ringSizeInc}
+    var result *sivq.Result
+    if *channelList != "" {
+        // multi-channel input from one image per channel
+        var channels []image.Image
+        for _, name := range strings.Fields(strings.Replace(*channelList, ",", " ", -1)) {
+            channels = append(channels, loadImage(name))
+        }
+        multiInput, err := sivq.NewMultiImageFromChannels(channels)
+        if err != nil {
+            log.Fatalln(err)
+        }
+        if *tissue {
+            log.Fatalln("-tissue is not supported with -channels")
+        }
+        sivqParams.Mask = roiMask(multiInput.Rect, nil)
 
-    sivqParams := SIVQParameters{
-        GammaAdjustment: float(*gammaAdj),
-        AverageBias    : float(*averageBias),
-        RotationStride:  float(*rotStride),
-        MatchingStride:  *matchStride,
-        MatchingOffset:  *matchOffset,
-        Threshold:       float(*threshold)}
+        if *posPoints != "" || *negPoints != "" {
+            log.Fatalln("-positives and -negatives are not supported with -channels")
+        }
+        vectorParams.Channels = multiInput.Channels
+        if len(examples) > 0 {
+            vectors = append(vectors, learnVector(sivqParams, examples, func(name string, x int, y int) *sivq.RingVector {
+                if name != "" {
+                    log.Fatalln("examples in other images are not supported with -channels")
+                }
+                ringVector := sivq.NewRingVector(vectorParams)
+                ringVector.LoadMulti(multiInput, x, y)
+                return ringVector
+            }))
+        } else if len(vectors) == 0 {
+            ringVector := sivq.NewRingVector(vectorParams)
+            ringVector.LoadMulti(multiInput, *vectorX, *vectorY)
+            vectors = append(vectors, ringVector)
+        }
+        saveVector(vectors)
 
-    ringVector := NewRingVector(vectorParams)
-    ringVector.LoadData(rgbaInput, *vectorX, *vectorY)
+        result, err = sivq.RunMultiVectors(sivq.Background(), sivqParams, multiInput, vectors)
+        if err != nil {
+            log.Fatalln(err)
+        }
+    } else {
+        rgbaInput := sivq.ConvertRGBA(loadImage(*inputName))
+        sivqParams.Mask = roiMask(rgbaInput.Bounds(), rgbaInput)
+        if *posPoints != "" || *negPoints != "" {
+            vectorParams, sivqParams = optimize(rgbaInput, vectorParams, sivqParams)
+        }
 
-    outputImage := SIVQ(sivqParams, rgbaInput, ringVector)
+        if len(examples) > 0 {
+            images := map[string]*image.RGBA{"": rgbaInput}
+            vectors = append(vectors, learnVector(sivqParams, examples, func(name string, x int, y int) *sivq.RingVector {
+                if images[name] == nil {
+                    images[name] = sivq.ConvertRGBA(loadImage(name))
+                }
+                return sivq.SampleExamples(vectorParams, []sivq.Example{{Image: images[name], X: x, Y: y}})[0]
+            }))
+        } else if len(vectors) == 0 {
+            ringVector := sivq.NewRingVector(vectorParams)
+            ringVector.LoadData(rgbaInput, *vectorX, *vectorY)
+            vectors = append(vectors, ringVector)
+        }
+        saveVector(vectors)
+
+        result, err = sivq.RunVectors(sivq.Background(), sivqParams, rgbaInput, vectors)
+        if err != nil {
+            log.Fatalln(err)
+        }
+    }
+    distances := result.Distance
+    if *printStats {
+        st := distances.Statistics()
+        pc := distances.Percentiles(0.05, 0.5, 0.95)
+        log.Printf("min %.4f max %.4f mean %.4f stddev %.4f p5 %.4f median %.4f p95 %.4f\n",
+            st.Min, st.Max, st.Mean, st.StdDev, pc[0], pc[1], pc[2])
+    }
+
+    outputThreshold, err := sivqParams.OutputThreshold(distances)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    if thresholdMethod != sivq.ThresholdManual {
+        log.Printf("%s threshold -T %.4f, distance %.4f\n", thresholdMethod, outputThreshold,
+            sivq.DistanceThreshold(sivqParams.GammaAdjustment, outputThreshold))
+    }
+
+    outputImage := distances.ToRGBA(sivqParams.GammaAdjustment, outputThreshold)
+    if *colormap != "" || *valueRange != "" || *overlay > 0 {
+        outputImage = distances.Heatmap(sivq.HeatmapParameters{
+            Colormap:  heatmapColormap,
+            Gamma:     sivqParams.GammaAdjustment,
+            Low:       low,
+            High:      high,
+            Threshold: outputThreshold})
+        if *overlay > 0 {
+            outputImage = sivq.Overlay(sivq.ConvertRGBA(loadImage(*inputName)), outputImage, sivq.Float(*overlay))
+        }
+    }
 
     if err = png.Encode(output, outputImage); err != nil {
         log.Fatalln(err)
     }
+
+    if *mirrorName != "" {
+        savePNG(*mirrorName, result.Mirrored)
+    }
+    if *scaleName != "" {
+        if result.Scale == nil {
+            log.Fatalln("-scaleOut needs -scales")
+        }
+        // brightness is the scale relative to the largest one
+        largest := sivq.Float(0)
+        for _, s := range scales {
+            if s > largest {
+                largest = s
+            }
+        }
+        for i, c := range result.Scale.Pix {
+            result.Scale.Pix[i].Y = c.Y / largest
+        }
+        savePNG(*scaleName, result.Scale)
+    }
+    if *orientName != "" {
+        savePNG(*orientName, result.OrientationRGBA(sivqParams.GammaAdjustment))
+    }
+    if *labelName != "" {
+        for i, name := range vectorNames {
+            c := sivq.LabelColor(i, len(vectors))
+            log.Printf("label %d %s: #%02x%02x%02x\n", i, name, c.R, c.G, c.B)
+        }
+        savePNG(*labelName, result.LabelRGBA(len(vectors), sivqParams.GammaAdjustment))
+        for i := 1; i < len(result.TopLabels); i++ {
+            top := &sivq.Result{Distance: result.TopDistances[i], Label: result.TopLabels[i]}
+            savePNG(fmt.Sprintf("%s.top%d.png", *labelName, i+1),
+                top.LabelRGBA(len(vectors), sivqParams.GammaAdjustment))
+        }
+    }
+    if *detectName != "" {
+        radius := *nmsRadius
+        if radius <= 0 {
+            for _, rv := range vectors {
+                if rv.MaxRadius > radius {
+                    radius = rv.MaxRadius
+                }
+            }
+        }
+        detect(result, sivq.DistanceThreshold(sivqParams.GammaAdjustment, outputThreshold), radius)
+    }
+    if *maskName != "" || *regionsName != "" {
+        regions(distances, sivq.DistanceThreshold(sivqParams.GammaAdjustment, outputThreshold))
+    }
+    if *contourName != "" {
+        contours(distances, sivq.DistanceThreshold(sivqParams.GammaAdjustment, outputThreshold))
+    }
+    if *truthName != "" || *truthPoints != "" {
+        evaluate(distances, sivq.DistanceThreshold(sivqParams.GammaAdjustment, outputThreshold))
+    }
+}
+
+// roiMask returns the intersection of the masks of -roi, -roiMask and
+// -tissue over input, or nil without any of them.
+func roiMask(bounds image.Rectangle, input *image.RGBA) *sivq.FloatGray {
+    var masks []*sivq.FloatGray
+    if *roiList != "" {
+        rects, err := sivq.ParseRects(*roiList)
+        if err != nil {
+            log.Fatalln(err)
+        }
+        masks = append(masks, sivq.RectMask(bounds.Dx(), bounds.Dy(), rects))
+    }
+    if *roiName != "" {
+        mask := sivq.NewMask(loadImage(*roiName))
+        if !mask.Bounds().Eq(image.Rect(0, 0, bounds.Dx(), bounds.Dy())) {
+            log.Fatalln("-roiMask and the input have different sizes")
+        }
+        masks = append(masks, mask)
+    }
+    if *tissue {
+        masks = append(masks, sivq.TissueMask(input, *tissueClose))
+    }
+    if len(masks) == 0 {
+        return nil
+    }
+
+    mask := masks[0]
+    for _, m := range masks[1:] {
+        mask = mask.Intersected(m)
+    }
+    selected := 0
+    for _, c := range mask.Pix {
+        if c.Y != 0 {
+            selected++
+        }
+    }
+    log.Printf("comparing %d pixels (%.2f%% of the image)\n", selected, 100*float64(selected)/float64(len(mask.Pix)))
+    return mask
+}
+
+// optimize searches the parameters of the vector at -X and -Y separating
+// -positives from -negatives best and logs them.
+func optimize(input *image.RGBA, rvp sivq.RingVectorParameters, p sivq.SIVQParameters) (sivq.RingVectorParameters, sivq.SIVQParameters) {
+    positives, err := sivq.ParsePoints(*posPoints)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    negatives, err := sivq.ParsePoints(*negPoints)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    best, err := sivq.Optimize(sivq.Background(), input, rvp, p, image.Point{*vectorX, *vectorY},
+        positives, negatives, sivq.DefaultSearchSpace)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    log.Printf("best -S %d -R %d -I %d -metric %s -M %d -K %g: score %.4f margin %.4f\n",
+        best.Vector.Radius, best.Vector.Count, best.Vector.RadiusInc, best.Params.Metric.Name(),
+        best.Params.MatchingStride, best.Params.RotationStride, best.Score, best.Margin)
+    return best.Vector, best.Params
+}
+
+// detect writes the detections of result to -detectOut.
+func detect(result *sivq.Result, threshold sivq.Float, radius int) {
+    detections := result.Detect(threshold, radius)
+    log.Printf("%d detections up to distance %.4f\n", len(detections), threshold)
+
+    output, err := os.OpenFile(*detectName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    defer output.Close()
+    if strings.HasSuffix(*detectName, ".json") {
+        var data []byte
+        if data, err = json.Marshal(detections); err == nil {
+            _, err = output.Write(data)
+        }
+    } else {
+        err = sivq.WriteDetectionsCSV(output, detections)
+    }
+    if err != nil {
+        log.Fatalln(err)
+    }
+}
+
+// regions thresholds distances, labels the regions of the mask and writes
+// them to -maskOut and -regionsOut.
+func regions(distances *sivq.FloatGray, threshold sivq.Float) {
+    mask := distances.MatchMask(threshold)
+    if *openRadius > 0 {
+        mask = mask.Opened(*openRadius)
+    }
+    if *closeRadius > 0 {
+        mask = mask.Closed(*closeRadius)
+    }
+    if *fillHoles {
+        mask = mask.HolesFilled()
+    }
+    labels, regions := mask.Regions(distances, *minArea)
+
+    area := 0
+    for _, r := range regions {
+        area += r.Area
+    }
+    computed := distances.Statistics().Count
+    if computed > 0 {
+        log.Printf("%d regions, area %d pixels (%.2f%% of computed)\n", len(regions), area,
+            100*float64(area)/float64(computed))
+    }
+
+    if *maskName != "" {
+        savePNG(*maskName, sivq.RegionsRGBA(labels, len(regions)))
+    }
+    if *regionsName != "" {
+        output, err := os.OpenFile(*regionsName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+        if err != nil {
+            log.Fatalln(err)
+        }
+        defer output.Close()
+        if err = sivq.WriteRegionsCSV(output, regions); err != nil {
+            log.Fatalln(err)
+        }
+    }
+}
+
+// contours traces the matches of distances and writes them to -contourOut.
+func contours(distances *sivq.FloatGray, threshold sivq.Float) {
+    polygons := distances.Contours(threshold, sivq.Float(*simplify))
+    log.Printf("%d contours up to distance %.4f\n", len(polygons), threshold)
+
+    output, err := os.OpenFile(*contourName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    defer output.Close()
+    if strings.HasSuffix(*contourName, ".svg") {
+        b := distances.Bounds()
+        err = sivq.WriteSVG(output, polygons, *inputName, b.Dx(), b.Dy())
+    } else {
+        err = sivq.WriteGeoJSON(output, polygons)
+    }
+    if err != nil {
+        log.Fatalln(err)
+    }
+}
+
+// evaluate compares distances with the ground truth of -truth or
+// -truthPoints, logs the summary and writes the curves to -evalOut.
+func evaluate(distances *sivq.FloatGray, threshold sivq.Float) {
+    var truth *sivq.FloatGray
+    if *truthName != "" {
+        truth = sivq.NewMask(loadImage(*truthName))
+    } else {
+        points, err := sivq.ParsePoints(*truthPoints)
+        if err != nil {
+            log.Fatalln(err)
+        }
+        b := distances.Bounds()
+        truth = sivq.PointMask(b.Dx(), b.Dy(), points, *pointRadius)
+    }
+
+    e, err := sivq.Evaluate(distances, truth, threshold)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    log.Printf("AUC %.4f AP %.4f best F1 %.4f at distance %.4f, Dice %.4f at distance %.4f\n",
+        e.AUC, e.AveragePrecision, e.Best.F1, e.Best.Threshold, e.Dice, e.Threshold)
+
+    if *evalName == "" {
+        return
+    }
+    output, err := os.OpenFile(*evalName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    defer output.Close()
+    if strings.HasSuffix(*evalName, ".json") {
+        var data []byte
+        if data, err = json.Marshal(e); err == nil {
+            _, err = output.Write(data)
+        }
+    } else {
+        err = e.WriteCSV(output)
+    }
+    if err != nil {
+        log.Fatalln(err)
+    }
 }
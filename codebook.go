@@ -0,0 +1,169 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "gob"
+    "image"
+    "image/png"
+    _ "image/jpeg"
+    "log"
+    "os"
+    "path"
+    "runtime"
+    "sivq"
+    "strings"
+)
+
+var (
+    inputList   = flag.String("in", "", "comma separated input images to sample")
+    outputList  = flag.String("out", "", "comma separated output pngs of the cluster of every pixel, <in>.codebook.png by default")
+    vectorDir   = flag.String("dir", "img/vec/", "directory the codebook vectors are saved in")
+    vectorName  = flag.String("name", "codebook", "name of the codebook, vectors are saved as <name>00, <name>01, ...")
+    codebookK   = flag.Int("k", 8, "number of codebook vectors")
+    sampleCount = flag.Int("n", 1000, "number of ring vectors sampled over all inputs")
+    iterations  = flag.Int("iterations", sivq.DefaultCodebookIterations, "maximum k-means iterations")
+    seed        = flag.Int64("seed", 1, "seed of the random sample locations")
+    vectorSize  = flag.Int("S", 4, "vector radius")
+    vectorRings = flag.Int("R", 1, "vector rings")
+    ringSizeInc = flag.Int("I", 2, "ring size increment")
+    rotStride   = flag.Float64("K", 0.001, "rotation stride")
+    colorSpace  = flag.String("color", "rgb", "color space: rgb, gray, hsv, lab, od or he")
+    weights     = flag.String("weights", "", "comma separated channel weights")
+    samplerName = flag.String("sampler", "bresenham", "ring sampler: bresenham, bilinear or bicubic")
+    ringSamples = flag.Int("samples", 0, "samples per ring for bilinear and bicubic, 0 for one per pixel of the largest ring")
+    metricName  = flag.String("metric", "rms", "distance metric: rms, l1, ncc, cosine or rank")
+    exactRot    = flag.Bool("exact", false, "compare all rotations exactly, rms metric only (ignores rotation stride)")
+    mirror      = flag.Bool("mirror", false, "also match the mirror image of the vectors")
+    matchStride = flag.Int("M", 1, "matching value stride (can be set to 3 for grayscale pictures)")
+    matchOffset = flag.Int("O", 0, "matching offset")
+    gammaAdj    = flag.Float64("g", 2.0, "gamma adjust")
+    workers     = flag.Int("P", 4, "number of worker threads")
+    borderMode  = flag.String("border", "skip", "border handling for the cluster images: skip, mirror, clamp or constant")
+)
+
+// loadImage decodes the image file name or exits.
+func loadImage(name string) image.Image {
+    input, err := os.OpenFile(name, os.O_RDONLY, 0666)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    defer input.Close()
+
+    m, _, err := image.Decode(input)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    return m
+}
+
+// saveVector gob encodes rv into the file name or exits.
+func saveVector(name string, rv *sivq.RingVector) {
+    output, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    defer output.Close()
+    if err = gob.NewEncoder(output).Encode(rv); err != nil {
+        log.Fatalln(err)
+    }
+}
+
+// savePNG encodes m into the file name or exits.
+func savePNG(name string, m image.Image) {
+    output, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    defer output.Close()
+    if err = png.Encode(output, m); err != nil {
+        log.Fatalln(err)
+    }
+}
+
+func main() {
+    flag.Parse()
+
+    runtime.GOMAXPROCS(*workers)
+
+    inputNames := strings.Fields(strings.Replace(*inputList, ",", " ", -1))
+    if len(inputNames) == 0 {
+        log.Fatalln("No input defined")
+    }
+    outputNames := strings.Fields(strings.Replace(*outputList, ",", " ", -1))
+    for len(outputNames) < len(inputNames) {
+        outputNames = append(outputNames, inputNames[len(outputNames)]+".codebook.png")
+    }
+
+    border, err := sivq.ParseBorderMode(*borderMode)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    metric, err := sivq.ParseMetric(*metricName)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    if *exactRot && metric != sivq.RMS {
+        log.Fatalln("-exact is only supported with -metric rms")
+    }
+    if _, err = sivq.ParseColorSpace(*colorSpace); err != nil {
+        log.Fatalln(err)
+    }
+    channelWeights, err := sivq.ParseWeights(*weights)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    if _, err = sivq.ParseSampler(*samplerName, *ringSamples); err != nil {
+        log.Fatalln(err)
+    }
+
+    vectorParams := sivq.RingVectorParameters{
+        Radius:     *vectorSize,
+        Count:      *vectorRings,
+        RadiusInc:  *ringSizeInc,
+        ColorSpace: *colorSpace,
+        Weights:    channelWeights,
+        Sampler:    *samplerName,
+        Samples:    *ringSamples}
+
+    sivqParams := sivq.SIVQParameters{
+        GammaAdjustment: sivq.Float(*gammaAdj),
+        RotationStride:  sivq.Float(*rotStride),
+        ExactRotation:   *exactRot,
+        Mirror:          *mirror,
+        Metric:          metric,
+        MatchingStride:  *matchStride,
+        MatchingOffset:  *matchOffset,
+        Workers:         *workers,
+        Border:          border}
+
+    inputs := make([]*image.RGBA, len(inputNames))
+    for i, name := range inputNames {
+        inputs[i] = sivq.ConvertRGBA(loadImage(name))
+    }
+
+    // cluster ring vectors sampled over all inputs
+    samples := sivq.SampleRandom(vectorParams, inputs, *sampleCount, *seed)
+    if len(samples) == 0 {
+        log.Fatalln("Inputs are smaller than the vector")
+    }
+    codebook, err := sivq.LearnCodebook(sivqParams, samples, *codebookK, *iterations)
+    if err != nil {
+        log.Fatalln(err)
+    }
+    for i, rv := range codebook {
+        name := fmt.Sprintf("%s%02d", *vectorName, i)
+        c := sivq.LabelColor(i, len(codebook))
+        log.Printf("vector %d %s: %d samples #%02x%02x%02x\n", i, name, rv.Examples, c.R, c.G, c.B)
+        saveVector(path.Join(*vectorDir, name), rv)
+    }
+
+    // assign every pixel to its best matching vector
+    for i, input := range inputs {
+        result, err := sivq.RunVectors(sivq.Background(), sivqParams, input, codebook)
+        if err != nil {
+            log.Fatalln(err)
+        }
+        savePNG(outputNames[i], result.LabelRGBA(len(codebook), sivqParams.GammaAdjustment))
+    }
+}
@@ -0,0 +1,204 @@
+package sivq
+
+import (
+    "image"
+    "math"
+    "os"
+)
+
+// BorderMode selects how rings that reach outside the image are sampled.
+type BorderMode int
+
+const (
+    BorderSkip     BorderMode = iota // pixels near the border are not computed
+    BorderMirror                     // the image is mirrored at its edges
+    BorderClamp                      // the nearest edge pixel is repeated
+    BorderConstant                   // outside pixels have SIVQParameters.BorderValue
+)
+
+var borderModeNames = []string{"skip", "mirror", "clamp", "constant"}
+
+func (m BorderMode) String() string {
+    if m < 0 || int(m) >= len(borderModeNames) {
+        return "unknown"
+    }
+    return borderModeNames[m]
+}
+
+// ParseBorderMode returns the BorderMode with the given name.
+func ParseBorderMode(name string) (BorderMode, os.Error) {
+    if name == "" {
+        return BorderSkip, nil
+    }
+    for i, n := range borderModeNames {
+        if n == name {
+            return BorderMode(i), nil
+        }
+    }
+    return BorderSkip, os.NewError("sivq: unknown border mode " + name)
+}
+
+// NotComputed is the value of distance map pixels that were not compared.
+// It renders as transparent so it can't be mistaken for a perfect match.
+func NotComputed() Float {
+    return Float(math.NaN())
+}
+
+// IsNotComputed reports whether v is the NotComputed value.
+func IsNotComputed(v Float) bool {
+    return v != v
+}
+
+// newNotComputedMap returns a w x h FloatGray where all pixels are
+// NotComputed.
+func newNotComputedMap(w int, h int) *FloatGray {
+    m := NewFloatGray(w, h)
+    for i := range m.Pix {
+        m.Pix[i] = FloatGrayColor{NotComputed()}
+    }
+    return m
+}
+
+// borderCoord maps coordinate v onto [0, n) according to mode. It returns
+// false when the value should come from the constant border instead.
+func borderCoord(v int, n int, mode BorderMode) (int, bool) {
+    if v >= 0 && v < n {
+        return v, true
+    }
+    switch mode {
+    case BorderClamp:
+        if v < 0 {
+            return 0, true
+        }
+        return n - 1, true
+    case BorderMirror:
+        if n == 1 {
+            return 0, true
+        }
+        period := 2 * (n - 1)
+        v = v % period
+        if v < 0 {
+            v += period
+        }
+        if v >= n {
+            v = period - v
+        }
+        return v, true
+    }
+    return 0, false
+}
+
+// computeRect returns the part of a w x h image that is compared by rings
+// reaching reach pixels from their center.
+func computeRect(mode BorderMode, reach int, w int, h int) image.Rectangle {
+    if mode != BorderSkip {
+        return image.Rect(0, 0, w, h)
+    }
+    r := image.Rect(reach, reach, w-reach, h-reach)
+    if r.Empty() {
+        return image.Rectangle{}
+    }
+    return r
+}
+
+// inside reports whether rings reaching reach pixels from (x, y) are inside
+// w x h.
+func inside(x int, y int, w int, h int, reach int) bool {
+    return x >= reach && y >= reach && x < w-reach && y < h-reach
+}
+
+// interpolate returns the weighted sum of the red, green and blue of pixels.
+func interpolate(pixels []image.RGBAColor, taps []Tap) (r Float, g Float, b Float) {
+    for i, t := range taps {
+        c := pixels[i]
+        r += t.Weight * Float(c.R)
+        g += t.Weight * Float(c.G)
+        b += t.Weight * Float(c.B)
+    }
+    return clamp255(r), clamp255(g), clamp255(b)
+}
+
+// clamp255 clamps v to [0, 255], bicubic interpolation may overshoot the
+// range.
+func clamp255(v Float) Float {
+    if v <= 0 {
+        return 0
+    } else if v >= 255 {
+        return 255
+    }
+    return v
+}
+
+// The border loaders sample a ring pixel by pixel. When any pixel a sample
+// is interpolated from comes from the constant border, the sample is the
+// border value.
+
+func (r *RingVectorRing) loadBorder(input *image.RGBA, conv *colorConverter, c Circle, X int, Y int, mode BorderMode, value Float) {
+    w, h := input.Rect.Dx(), input.Rect.Dy()
+    taps, n := c.GetTaps(r.Radius)
+    pixels := make([]image.RGBAColor, n)
+    i2 := 0
+    for i := 0; i < len(taps); i += n {
+        ok := true
+        for j, t := range taps[i : i+n] {
+            x, okX := borderCoord(X+t.X, w, mode)
+            y, okY := borderCoord(Y+t.Y, h, mode)
+            if !okX || !okY {
+                ok = false
+                break
+            }
+            pixels[j] = input.Pix[y*input.Stride+x]
+        }
+        if !ok {
+            for c := 0; c < r.Stride; c++ {
+                r.Data[i2+c] = value
+            }
+        } else if n == 1 {
+            conv.set(r.Data[i2:], pixels[0])
+        } else {
+            cr, cg, cb := interpolate(pixels, taps[i:i+n])
+            conv.setFloat(r.Data[i2:], cr, cg, cb)
+        }
+        i2 += r.Stride
+    }
+}
+
+func (r *RingVectorRing) loadBorderGray(input *FloatGray, c Circle, X int, Y int, mode BorderMode, value Float) {
+    w, h := input.Rect.Dx(), input.Rect.Dy()
+    taps, n := c.GetTaps(r.Radius)
+    i2 := 0
+    for i := 0; i < len(taps); i += n {
+        var v Float
+        for _, t := range taps[i : i+n] {
+            x, okX := borderCoord(X+t.X, w, mode)
+            y, okY := borderCoord(Y+t.Y, h, mode)
+            if !okX || !okY {
+                v = value
+                break
+            }
+            v += t.Weight * input.Pix[y*input.Stride+x].Y
+        }
+        for c := 0; c < r.Stride; c++ {
+            r.Data[i2+c] = v
+        }
+        i2 += r.Stride
+    }
+}
+
+// loadBorder is LoadData for locations where the rings may reach outside
+// of the image.
+func (rv *RingVector) loadBorder(input *image.RGBA, conv *colorConverter, X int, Y int, mode BorderMode, value Float) {
+    c := rv.sampler()
+    for i := range rv.Rings {
+        rv.Rings[i].loadBorder(input, conv, c, X, Y, mode, value)
+    }
+}
+
+// loadBorderGray is LoadDataGray for locations where the rings may reach
+// outside of the image.
+func (rv *RingVector) loadBorderGray(input *FloatGray, X int, Y int, mode BorderMode, value Float) {
+    c := rv.sampler()
+    for i := range rv.Rings {
+        rv.Rings[i].loadBorderGray(input, c, X, Y, mode, value)
+    }
+}
@@ -0,0 +1,326 @@
+package sivq
+
+import (
+    "math"
+    "os"
+    "strconv"
+    "sync"
+)
+
+
+const (
+    Tau = Float(2 * math.Pi)
+)
+
+// Circle selects the samples of a ring. GetRing returns the nearest pixel of
+// every sample, GetTaps the pixels and weights the samples are interpolated
+// from.
+type Circle interface {
+    Run(size int, f SamplingFunc)
+    GetPixelCount(size int) int
+    GetRing(radius int) (*LocationArray, int)
+    // GetTaps returns perSample consecutive taps for every sample of the
+    // ring, the weights of a sample sum to 1.
+    GetTaps(radius int) (taps []Tap, perSample int)
+}
+
+// Tap is a pixel, relative to the ring center, that contributes Weight to
+// a ring sample.
+type Tap struct {
+    X      int
+    Y      int
+    Weight Float
+}
+
+type SamplingFunc func(x int, y int, idx int)
+
+func SamplingRing(size int, count int, f SamplingFunc) {
+    var x, y, d int
+    var sec4, sec3, sec2, sec1 int
+    x = 0
+    y = size
+    d = 3 - 2*size
+    
+    sec1 = count/4;
+    sec2 = 2*sec1;
+    sec3 = 3*sec1;
+    sec4 = 4*sec1;
+    
+    for x <= y {
+        f(x, y, x)
+        if x != 0 { f(-x,  y, sec4 - x) }
+        if y != 0 { f( x, -y, sec2 - x) }
+        if (x != 0) && (y != 0) { f(-x, -y, sec2 + x) }
+        if x != y {
+            f(y, x, sec1 - x)
+            if  x != 0 { f( y, -x, sec1 + x) }
+            if  y != 0 { f(-y,  x, sec3 + x) }
+            if  (x != 0) && (y != 0) { f(-y, -x, sec3 - x) }
+        }
+        
+        if d <= 0 {
+            d += 4*x + 6
+        } else {
+            d += 4*(x-y) + 10
+            y -= 1
+        }
+        x += 1
+    }
+}
+
+type Point struct {
+    X int
+    Y int
+}
+
+type LocationArray []Point
+type IntLocationArrayMap map[int]LocationArray
+
+// Bresenham caches rings calculated with the midpoint circle algorithm.
+// It is safe for concurrent use.
+type Bresenham struct {
+    PixelCount map[int]int
+    Pixels     IntLocationArrayMap
+
+    lock sync.Mutex
+    taps map[int][]Tap
+}
+
+func NewBresenham() *Bresenham {
+    return &Bresenham{PixelCount: make(map[int]int), Pixels: make(IntLocationArrayMap),
+        taps: make(map[int][]Tap)}
+}
+
+func (b *Bresenham) CalculateRing(radius int) {
+    pxls := 0
+    SamplingRing(radius, 0, func(x int, y int, idx int) { pxls += 1 })
+    b.PixelCount[radius] = pxls
+
+    arr := make(LocationArray, pxls)
+    SamplingRing(radius, pxls,
+        func(x int, y int, idx int) {
+            arr[idx] = Point{x, y}
+        })
+    b.Pixels[radius] = arr
+}
+
+func (b *Bresenham) GetRing(radius int) (*LocationArray, int) {
+    b.lock.Lock()
+    defer b.lock.Unlock()
+
+    if count, ok := b.PixelCount[radius]; ok {
+        arr := b.Pixels[radius]
+        return &arr, count
+    }
+
+    b.CalculateRing(radius)
+    count := b.PixelCount[radius]
+    arr := b.Pixels[radius]
+
+    return &arr, count
+}
+
+func (b *Bresenham) GetPixelCount(radius int) int {
+    _, count := b.GetRing(radius)
+    return count
+}
+
+func (b *Bresenham) Run(size int, f SamplingFunc) {
+    pxls, count := b.GetRing(size)
+    for i := 0; i < count; i += 1 {
+        f((*pxls)[i].X, (*pxls)[i].Y, i)
+    }
+}
+
+// GetTaps returns every ring pixel as a single tap with weight 1.
+func (b *Bresenham) GetTaps(radius int) ([]Tap, int) {
+    pxls, count := b.GetRing(radius)
+
+    b.lock.Lock()
+    defer b.lock.Unlock()
+
+    if taps, ok := b.taps[radius]; ok {
+        return taps, 1
+    }
+    taps := make([]Tap, count)
+    for i := 0; i < count; i += 1 {
+        taps[i] = Tap{(*pxls)[i].X, (*pxls)[i].Y, 1}
+    }
+    b.taps[radius] = taps
+    return taps, 1
+}
+
+// Interpolated samples a ring at evenly spaced angles and interpolates the
+// image between pixels, so that a rotation step has the same size on every
+// ring. It is safe for concurrent use. NewRingVector always sets Samples,
+// 0 is only left in vectors saved before.
+type Interpolated struct {
+    Samples int  // samples per ring, 0 for one per pixel of each circumference
+    Cubic   bool // bicubic instead of bilinear interpolation
+
+    lock   sync.Mutex
+    pixels IntLocationArrayMap
+    taps   map[int][]Tap
+}
+
+func NewInterpolated(samples int, cubic bool) *Interpolated {
+    return &Interpolated{Samples: samples, Cubic: cubic,
+        pixels: make(IntLocationArrayMap), taps: make(map[int][]Tap)}
+}
+
+// count returns the number of samples in the ring with the given radius.
+func (c *Interpolated) count(radius int) int {
+    return ringSamples(c.Samples, radius)
+}
+
+// ringSamples returns samples if set and otherwise about one sample per
+// pixel of the circumference of a ring of radius.
+func ringSamples(samples int, radius int) int {
+    if samples > 0 {
+        return samples
+    }
+    n := int(Tau*Float(radius) + 0.5)
+    if n < 1 {
+        n = 1
+    }
+    return n
+}
+
+// interpolated reports whether the sampler name is that of an Interpolated.
+func interpolated(name string) bool {
+    return name == "bilinear" || name == "bicubic"
+}
+
+// weights returns the interpolation weights of the pixels around a sample
+// at fraction t between two pixels, starting with the pixel at floor - 1
+// for bicubic and at floor for bilinear interpolation.
+func (c *Interpolated) weights(t Float) []Float {
+    if !c.Cubic {
+        return []Float{1 - t, t}
+    }
+    // Catmull-Rom spline
+    t2 := t * t
+    t3 := t2 * t
+    return []Float{
+        (-t3 + 2*t2 - t) / 2,
+        (3*t3 - 5*t2 + 2) / 2,
+        (-3*t3 + 4*t2 + t) / 2,
+        (t3 - t2) / 2}
+}
+
+func (c *Interpolated) calculateRing(radius int) {
+    count := c.count(radius)
+    pxls := make(LocationArray, count)
+    var taps []Tap
+    for i := 0; i < count; i += 1 {
+        // same direction as SamplingRing, starting from (0, radius)
+        angle := float64(Tau) * float64(i) / float64(count)
+        fx := float64(radius) * math.Sin(angle)
+        fy := float64(radius) * math.Cos(angle)
+        pxls[i] = Point{int(math.Floor(fx + 0.5)), int(math.Floor(fy + 0.5))}
+
+        x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+        wx := c.weights(Float(fx - float64(x0)))
+        wy := c.weights(Float(fy - float64(y0)))
+        if c.Cubic {
+            x0, y0 = x0-1, y0-1
+        }
+        for j, vy := range wy {
+            for k, vx := range wx {
+                taps = append(taps, Tap{x0 + k, y0 + j, vx * vy})
+            }
+        }
+    }
+    c.pixels[radius] = pxls
+    c.taps[radius] = taps
+}
+
+func (c *Interpolated) GetRing(radius int) (*LocationArray, int) {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+
+    if _, ok := c.pixels[radius]; !ok {
+        c.calculateRing(radius)
+    }
+    arr := c.pixels[radius]
+    return &arr, len(arr)
+}
+
+func (c *Interpolated) GetPixelCount(radius int) int {
+    return c.count(radius)
+}
+
+func (c *Interpolated) Run(size int, f SamplingFunc) {
+    pxls, count := c.GetRing(size)
+    for i := 0; i < count; i += 1 {
+        f((*pxls)[i].X, (*pxls)[i].Y, i)
+    }
+}
+
+func (c *Interpolated) GetTaps(radius int) ([]Tap, int) {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+
+    if _, ok := c.taps[radius]; !ok {
+        c.calculateRing(radius)
+    }
+    perSample := 4
+    if c.Cubic {
+        perSample = 16
+    }
+    return c.taps[radius], perSample
+}
+
+// Samplers lists the names accepted by ParseSampler.
+var Samplers = []string{"bresenham", "bilinear", "bicubic"}
+
+var (
+    samplerLock sync.Mutex
+    samplers    = make(map[string]Circle)
+)
+
+// ParseSampler returns the Circle with the given name, "" being bresenham.
+// samples is the number of samples per ring for the interpolated samplers,
+// 0 for about one per pixel of circumference. The same Circle is returned
+// for the same arguments so its rings are calculated only once.
+func ParseSampler(name string, samples int) (Circle, os.Error) {
+    if samples < 0 {
+        samples = 0
+    }
+    if name == "" || name == "bresenham" {
+        return circle, nil
+    } else if !interpolated(name) {
+        return nil, os.NewError("sivq: unknown sampler " + name)
+    }
+
+    samplerLock.Lock()
+    defer samplerLock.Unlock()
+
+    key := name + ":" + strconv.Itoa(samples)
+    if c, ok := samplers[key]; ok {
+        return c, nil
+    }
+    c := NewInterpolated(samples, name == "bicubic")
+    samplers[key] = c
+    return c, nil
+}
+
+// ringReach returns how far from the center the taps of the ring with the
+// given radius reach.
+func ringReach(c Circle, radius int) int {
+    taps, _ := c.GetTaps(radius)
+    reach := 0
+    for _, t := range taps {
+        if t.X > reach {
+            reach = t.X
+        } else if -t.X > reach {
+            reach = -t.X
+        }
+        if t.Y > reach {
+            reach = t.Y
+        } else if -t.Y > reach {
+            reach = -t.Y
+        }
+    }
+    return reach
+}
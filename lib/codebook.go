@@ -0,0 +1,181 @@
+package sivq
+
+import (
+    "image"
+    "os"
+    "rand"
+    "runtime"
+    "sync"
+)
+
+// DefaultCodebookIterations is the number of k-means iterations used when
+// LearnCodebook is given 0.
+const DefaultCodebookIterations = 10
+
+// SampleRandom returns count RingVectors with the parameters rvp sampled at
+// random locations of inputs, where the whole ring lies inside the image.
+// Larger images get proportionally more samples.
+func SampleRandom(rvp RingVectorParameters, inputs []*image.RGBA, count int, seed int64) []*RingVector {
+    reach := NewRingVector(rvp).reach()
+    areas := make([]int, len(inputs))
+    total := 0
+    for i, input := range inputs {
+        w := input.Bounds().Dx() - 2*reach
+        h := input.Bounds().Dy() - 2*reach
+        if w > 0 && h > 0 {
+            areas[i] = w * h
+        }
+        total += areas[i]
+    }
+    if total == 0 {
+        return nil
+    }
+
+    r := rand.New(rand.NewSource(seed))
+    samples := make([]*RingVector, count)
+    for i := range samples {
+        // pick a pixel uniformly over all images
+        n := r.Intn(total)
+        input := 0
+        for n >= areas[input] {
+            n -= areas[input]
+            input++
+        }
+        w := inputs[input].Bounds().Dx() - 2*reach
+        samples[i] = NewRingVector(rvp)
+        samples[i].LoadData(inputs[input], reach+n%w, reach+n/w)
+    }
+    return samples
+}
+
+// LearnCodebook clusters samples into k vectors with k-means using the
+// distance of p, which includes the best rotation and, with p.Mirror, the
+// mirror image. Every cluster is the average of its samples aligned to the
+// cluster as in LearnPrototype. The initial vectors are chosen farthest
+// first, so the result only depends on the order of samples. Vectors are
+// returned from the largest cluster to the smallest, with Examples set to
+// the cluster size.
+func LearnCodebook(p SIVQParameters, samples []*RingVector, k int, iterations int) ([]*RingVector, os.Error) {
+    if k <= 0 {
+        return nil, os.NewError("sivq: codebook size must be positive")
+    }
+    if len(samples) < k {
+        return nil, os.NewError("sivq: fewer samples than codebook vectors")
+    }
+    if err := p.checkExact(); err != nil {
+        return nil, err
+    }
+    for _, s := range samples[1:] {
+        if !samples[0].sameRings(s) {
+            return nil, os.NewError("sivq: samples have different rings")
+        }
+    }
+    if iterations <= 0 {
+        iterations = DefaultCodebookIterations
+    }
+
+    nearest := make([]Match, len(samples))
+    labels := make([]int, len(samples))
+
+    // farthest first initialization
+    codebook := []*RingVector{samples[0].Clone()}
+    assign(p, codebook, samples, nearest, labels, 0)
+    for len(codebook) < k {
+        codebook = append(codebook, samples[farthest(nearest)].Clone())
+        assign(p, codebook, samples, nearest, labels, len(codebook)-1)
+    }
+
+    for iteration := 0; iteration < iterations; iteration++ {
+        members := make([][]*RingVector, k)
+        for i, s := range samples {
+            members[labels[i]] = append(members[labels[i]], s.aligned(nearest[i]))
+        }
+        for c := range codebook {
+            if len(members[c]) > 0 {
+                codebook[c] = average(members[c])
+            } else {
+                // restart an empty cluster at the worst represented sample
+                i := farthest(nearest)
+                codebook[c] = samples[i].Clone()
+                nearest[i].Distance = 0
+            }
+        }
+
+        previous := make([]int, len(labels))
+        copy(previous, labels)
+        assign(p, codebook, samples, nearest, labels, 0)
+        changed := false
+        for i := range labels {
+            if labels[i] != previous[i] {
+                changed = true
+                break
+            }
+        }
+        if !changed {
+            break
+        }
+    }
+
+    // count the cluster sizes and sort from the largest
+    for c := range codebook {
+        codebook[c].Examples = 0
+    }
+    for _, label := range labels {
+        codebook[label].Examples++
+    }
+    for i := 1; i < len(codebook); i++ {
+        for j := i; j > 0 && codebook[j].Examples > codebook[j-1].Examples; j-- {
+            codebook[j], codebook[j-1] = codebook[j-1], codebook[j]
+        }
+    }
+    return codebook, nil
+}
+
+// farthest returns the index of the sample farthest from its vector.
+func farthest(nearest []Match) int {
+    best := 0
+    for i, m := range nearest {
+        if m.Distance > nearest[best].Distance {
+            best = i
+        }
+    }
+    return best
+}
+
+// assign updates the nearest vector of every sample with the codebook
+// vectors from first on. Samples are split over p.Workers goroutines.
+func assign(p SIVQParameters, codebook []*RingVector, samples []*RingVector, nearest []Match, labels []int, first int) {
+    matchers := make([]*matcher, len(codebook))
+    for c := first; c < len(codebook); c++ {
+        matchers[c] = newMatcher(codebook[c], p)
+    }
+
+    workers := p.Workers
+    if workers <= 0 {
+        workers = runtime.GOMAXPROCS(0)
+    }
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func(w int) {
+            defer wg.Done()
+            matches := make([]func(B *RingVector) Match, len(codebook))
+            for c := first; c < len(codebook); c++ {
+                matches[c] = matchers[c].newWorker()
+            }
+            for i := w; i < len(samples); i += workers {
+                for c := first; c < len(codebook); c++ {
+                    B := samples[i]
+                    if matchers[c].prepare != nil {
+                        B = B.Clone()
+                    }
+                    m := matches[c](B)
+                    if c == 0 || m.Distance < nearest[i].Distance {
+                        nearest[i], labels[i] = m, c
+                    }
+                }
+            }
+        }(w)
+    }
+    wg.Wait()
+}
@@ -0,0 +1,341 @@
+package sivq
+
+import (
+    "image"
+    "math"
+    "os"
+    "strconv"
+    "strings"
+)
+
+// ColorSpace converts an RGB pixel into the channels that are stored in
+// ring data and compared. ConvertFloat converts interpolated samples whose
+// components range from 0 to 255 without rounding them to 8 bits.
+type ColorSpace interface {
+    Name() string
+    Channels() int
+    Convert(c image.RGBAColor, out []Float)
+    ConvertFloat(r Float, g Float, b Float, out []Float)
+}
+
+var (
+    RGB  ColorSpace = rgbSpace{}  // red, green, blue
+    Gray ColorSpace = graySpace{} // luminance only, a single channel
+    HSV  ColorSpace = hsvSpace{}  // hue, saturation, value
+    Lab  ColorSpace = labSpace{}  // CIE L*a*b* with D65 white
+    OD   ColorSpace = odSpace{}   // optical density of red, green and blue
+    HE   ColorSpace = heSpace{}   // hematoxylin, eosin and residual stain density
+)
+
+// ColorSpaces lists all color spaces known to ParseColorSpace.
+var ColorSpaces = []ColorSpace{RGB, Gray, HSV, Lab, OD, HE}
+
+// ParseColorSpace returns the color space with the given name, RGB for "".
+func ParseColorSpace(name string) (ColorSpace, os.Error) {
+    if name == "" {
+        return RGB, nil
+    }
+    for _, cs := range ColorSpaces {
+        if cs.Name() == name {
+            return cs, nil
+        }
+    }
+    return nil, os.NewError("sivq: unknown color space " + name)
+}
+
+// ParseWeights parses comma separated channel weights such as "1,0.5,0".
+func ParseWeights(s string) ([]Float, os.Error) {
+    return parseFloats(s)
+}
+
+// parseFloats parses a comma or space separated list of numbers.
+func parseFloats(s string) ([]Float, os.Error) {
+    fields := strings.Fields(strings.Replace(s, ",", " ", -1))
+    values := make([]Float, len(fields))
+    for i, field := range fields {
+        v, err := strconv.Atof64(field)
+        if err != nil {
+            return nil, err
+        }
+        values[i] = Float(v)
+    }
+    return values, nil
+}
+
+// colorConverter fills ring data from pixels using the color space and the
+// channel weights of a RingVector.
+type colorConverter struct {
+    space    ColorSpace // nil for plain RGB
+    channels int
+    weights  []Float // nil when all weights are 1
+}
+
+// newRGBConverter returns a colorConverter that stores plain RGB values.
+func newRGBConverter() *colorConverter {
+    return &colorConverter{channels: 3}
+}
+
+// converter returns the colorConverter for the color space and weights
+// recorded in rv. Unknown color spaces are treated as RGB; Run reports them
+// as an error.
+func (rv *RingVector) converter() *colorConverter {
+    c := newRGBConverter()
+    if cs, err := ParseColorSpace(rv.ColorSpace); err == nil && cs != RGB {
+        c.space = cs
+        c.channels = cs.Channels()
+    }
+    for _, w := range rv.Weights {
+        if w != 1.0 {
+            c.weights = rv.Weights
+            break
+        }
+    }
+    return c
+}
+
+func (c *colorConverter) set(data []Float, pixel image.RGBAColor) {
+    if c.space == nil {
+        data[0] = Float(pixel.R) / 255.0
+        data[1] = Float(pixel.G) / 255.0
+        data[2] = Float(pixel.B) / 255.0
+    } else {
+        c.space.Convert(pixel, data)
+    }
+    c.weigh(data)
+}
+
+// setFloat is set for an interpolated sample with components from 0 to 255.
+func (c *colorConverter) setFloat(data []Float, r Float, g Float, b Float) {
+    if c.space == nil {
+        data[0] = r / 255.0
+        data[1] = g / 255.0
+        data[2] = b / 255.0
+    } else {
+        c.space.ConvertFloat(r, g, b, data)
+    }
+    c.weigh(data)
+}
+
+func (c *colorConverter) weigh(data []Float) {
+    for i, w := range c.weights {
+        if i < c.channels {
+            data[i] *= w
+        }
+    }
+}
+
+type rgbSpace struct{}
+
+func (rgbSpace) Name() string  { return "rgb" }
+func (rgbSpace) Channels() int { return 3 }
+
+func (rgbSpace) Convert(c image.RGBAColor, out []Float) {
+    out[0] = Float(c.R) / 255.0
+    out[1] = Float(c.G) / 255.0
+    out[2] = Float(c.B) / 255.0
+}
+
+func (rgbSpace) ConvertFloat(r Float, g Float, b Float, out []Float) {
+    out[0] = r / 255.0
+    out[1] = g / 255.0
+    out[2] = b / 255.0
+}
+
+type graySpace struct{}
+
+func (graySpace) Name() string  { return "gray" }
+func (graySpace) Channels() int { return 1 }
+
+func (graySpace) Convert(c image.RGBAColor, out []Float) {
+    out[0] = (0.3*Float(c.R) + 0.59*Float(c.G) + 0.11*Float(c.B)) / 255.0
+}
+
+func (graySpace) ConvertFloat(r Float, g Float, b Float, out []Float) {
+    out[0] = (0.3*r + 0.59*g + 0.11*b) / 255.0
+}
+
+type hsvSpace struct{}
+
+func (hsvSpace) Name() string  { return "hsv" }
+func (hsvSpace) Channels() int { return 3 }
+
+func (s hsvSpace) Convert(c image.RGBAColor, out []Float) {
+    s.ConvertFloat(Float(c.R), Float(c.G), Float(c.B), out)
+}
+
+func (hsvSpace) ConvertFloat(r Float, g Float, b Float, out []Float) {
+    r /= 255.0
+    g /= 255.0
+    b /= 255.0
+
+    max, min := r, r
+    if g > max {
+        max = g
+    }
+    if b > max {
+        max = b
+    }
+    if g < min {
+        min = g
+    }
+    if b < min {
+        min = b
+    }
+    delta := max - min
+
+    var h, s Float
+    if delta > 0 {
+        switch max {
+        case r:
+            h = (g - b) / delta
+            if h < 0 {
+                h += 6
+            }
+        case g:
+            h = (b-r)/delta + 2
+        default:
+            h = (r-g)/delta + 4
+        }
+        h /= 6
+    }
+    if max > 0 {
+        s = delta / max
+    }
+    out[0], out[1], out[2] = h, s, max
+}
+
+// srgbLinear maps 8 bit sRGB values to linear intensities.
+var srgbLinear [256]float64
+
+// opticalDensity maps 8 bit intensities to optical density scaled so that
+// the darkest value is 1.0.
+var opticalDensity [256]float64
+
+// linear returns the linear intensity of the sRGB value v from 0 to 255.
+func linear(v float64) float64 {
+    v /= 255.0
+    if v <= 0.04045 {
+        return v / 12.92
+    }
+    return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// density returns the optical density of the intensity v from 0 to 255.
+func density(v float64) float64 {
+    return -math.Log10((v+1)/256) / math.Log10(256)
+}
+
+// heInverse converts optical densities into hematoxylin, eosin and residual
+// stain amounts. It is the inverse of the stain matrix of Ruifrok and
+// Johnston, "Quantification of histochemical staining by color
+// deconvolution".
+var heInverse [3][3]float64
+
+func init() {
+    for i := range srgbLinear {
+        srgbLinear[i] = linear(float64(i))
+        opticalDensity[i] = density(float64(i))
+    }
+
+    hematoxylin := normalize3([3]float64{0.650, 0.704, 0.286})
+    eosin := normalize3([3]float64{0.072, 0.990, 0.105})
+    residual := normalize3([3]float64{
+        hematoxylin[1]*eosin[2] - hematoxylin[2]*eosin[1],
+        hematoxylin[2]*eosin[0] - hematoxylin[0]*eosin[2],
+        hematoxylin[0]*eosin[1] - hematoxylin[1]*eosin[0]})
+    heInverse = invert3([3][3]float64{hematoxylin, eosin, residual})
+}
+
+func normalize3(v [3]float64) [3]float64 {
+    length := math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+    return [3]float64{v[0] / length, v[1] / length, v[2] / length}
+}
+
+// invert3 returns the inverse of the matrix whose rows are m.
+func invert3(m [3][3]float64) [3][3]float64 {
+    det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+        m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+        m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+    var inv [3][3]float64
+    inv[0][0] = (m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det
+    inv[0][1] = (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det
+    inv[0][2] = (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det
+    inv[1][0] = (m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det
+    inv[1][1] = (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det
+    inv[1][2] = (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det
+    inv[2][0] = (m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det
+    inv[2][1] = (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det
+    inv[2][2] = (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det
+    return inv
+}
+
+type labSpace struct{}
+
+func (labSpace) Name() string  { return "lab" }
+func (labSpace) Channels() int { return 3 }
+
+func labF(t float64) float64 {
+    if t > 216.0/24389.0 {
+        return math.Cbrt(t)
+    }
+    return (24389.0/27.0*t + 16) / 116
+}
+
+// Convert stores L/100, a/256 and b/256 so that all channels have a range of
+// about 1.0.
+func (labSpace) Convert(c image.RGBAColor, out []Float) {
+    labConvert(srgbLinear[c.R], srgbLinear[c.G], srgbLinear[c.B], out)
+}
+
+func (labSpace) ConvertFloat(r Float, g Float, b Float, out []Float) {
+    labConvert(linear(float64(r)), linear(float64(g)), linear(float64(b)), out)
+}
+
+// labConvert converts linear intensities to L*a*b*.
+func labConvert(r float64, g float64, b float64, out []Float) {
+    x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+    y := 0.2126*r + 0.7152*g + 0.0722*b
+    z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+
+    fx, fy, fz := labF(x), labF(y), labF(z)
+    out[0] = Float((116*fy - 16) / 100)
+    out[1] = Float(500 * (fx - fy) / 256)
+    out[2] = Float(200 * (fy - fz) / 256)
+}
+
+type odSpace struct{}
+
+func (odSpace) Name() string  { return "od" }
+func (odSpace) Channels() int { return 3 }
+
+func (odSpace) Convert(c image.RGBAColor, out []Float) {
+    out[0] = Float(opticalDensity[c.R])
+    out[1] = Float(opticalDensity[c.G])
+    out[2] = Float(opticalDensity[c.B])
+}
+
+func (odSpace) ConvertFloat(r Float, g Float, b Float, out []Float) {
+    out[0] = Float(density(float64(r)))
+    out[1] = Float(density(float64(g)))
+    out[2] = Float(density(float64(b)))
+}
+
+type heSpace struct{}
+
+func (heSpace) Name() string  { return "he" }
+func (heSpace) Channels() int { return 3 }
+
+func (heSpace) Convert(c image.RGBAColor, out []Float) {
+    heConvert([3]float64{opticalDensity[c.R], opticalDensity[c.G], opticalDensity[c.B]}, out)
+}
+
+func (heSpace) ConvertFloat(r Float, g Float, b Float, out []Float) {
+    heConvert([3]float64{density(float64(r)), density(float64(g)), density(float64(b))}, out)
+}
+
+// heConvert separates optical densities into stain amounts.
+func heConvert(od [3]float64, out []Float) {
+    for i := 0; i < 3; i++ {
+        out[i] = Float(od[0]*heInverse[0][i] + od[1]*heInverse[1][i] + od[2]*heInverse[2][i])
+    }
+}
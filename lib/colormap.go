@@ -0,0 +1,147 @@
+package sivq
+
+import (
+    "image"
+    "math"
+    "os"
+)
+
+// Colormap is a palette for values from 0 to 1, interpolated between
+// evenly spaced stops.
+type Colormap struct {
+    Name  string
+    Stops []image.RGBAColor
+}
+
+var (
+    // black to white, as ToRGBA
+    GrayColormap = &Colormap{"gray", []image.RGBAColor{{0, 0, 0, 255}, {255, 255, 255, 255}}}
+
+    // perceptually uniform blue to yellow
+    ViridisColormap = &Colormap{"viridis", []image.RGBAColor{
+        {68, 1, 84, 255}, {71, 45, 123, 255}, {59, 82, 139, 255}, {44, 114, 142, 255}, {33, 145, 140, 255},
+        {40, 174, 128, 255}, {94, 201, 98, 255}, {173, 220, 48, 255}, {253, 231, 37, 255}}}
+
+    // perceptually uniform black to light yellow
+    MagmaColormap = &Colormap{"magma", []image.RGBAColor{
+        {0, 0, 4, 255}, {28, 16, 68, 255}, {79, 18, 123, 255}, {129, 37, 129, 255}, {181, 54, 122, 255},
+        {229, 80, 100, 255}, {251, 135, 97, 255}, {254, 194, 135, 255}, {252, 253, 191, 255}}}
+
+    // rainbow from dark blue to dark red
+    JetColormap = &Colormap{"jet", []image.RGBAColor{
+        {0, 0, 128, 255}, {0, 0, 255, 255}, {0, 128, 255, 255}, {0, 255, 255, 255}, {128, 255, 128, 255},
+        {255, 255, 0, 255}, {255, 128, 0, 255}, {255, 0, 0, 255}, {128, 0, 0, 255}}}
+)
+
+// Colormaps lists all colormaps known to ParseColormap.
+var Colormaps = []*Colormap{GrayColormap, ViridisColormap, MagmaColormap, JetColormap}
+
+// ParseColormap returns the colormap with the given name, GrayColormap for "".
+func ParseColormap(name string) (*Colormap, os.Error) {
+    if name == "" {
+        return GrayColormap, nil
+    }
+    for _, m := range Colormaps {
+        if m.Name == name {
+            return m, nil
+        }
+    }
+    return nil, os.NewError("sivq: unknown colormap " + name)
+}
+
+// ParseRange parses the comma separated low and high strengths of
+// HeatmapParameters, 0 and 1 for "".
+func ParseRange(s string) (low Float, high Float, err os.Error) {
+    values, err := parseFloats(s)
+    if err != nil {
+        return 0, 0, err
+    }
+    if len(values) == 0 {
+        return 0, 1, nil
+    }
+    if len(values) != 2 || values[0] >= values[1] {
+        return 0, 0, os.NewError("sivq: invalid range " + s)
+    }
+    return values[0], values[1], nil
+}
+
+// Color returns the color of v, clamped to [0, 1].
+func (m *Colormap) Color(v Float) image.RGBAColor {
+    if !(v > 0) {
+        return m.Stops[0]
+    } else if v >= 1 {
+        return m.Stops[len(m.Stops)-1]
+    }
+    v *= Float(len(m.Stops) - 1)
+    i := int(v)
+    f := v - Float(i)
+    a, b := m.Stops[i], m.Stops[i+1]
+    mix := func(a uint8, b uint8) uint8 {
+        return uint8(Float(a) + f*(Float(b)-Float(a)) + 0.5)
+    }
+    return image.RGBAColor{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+// HeatmapParameters set how Heatmap renders a distance map. Distances are
+// turned into match strengths with the gamma as in ToRGBA, so that 1.0 is
+// a perfect match.
+type HeatmapParameters struct {
+    Colormap  *Colormap // GrayColormap if nil
+    Gamma     Float
+    Low       Float // strength drawn with the first color
+    High      Float // strength drawn with the last color, Low >= High for 0 and 1
+    Threshold Float // strengths below are transparent
+}
+
+// Heatmap renders the match strengths of the distance map with the
+// colormap of hp. Pixels that were not computed or are below the threshold
+// are transparent.
+func (p *FloatGray) Heatmap(hp HeatmapParameters) *image.RGBA {
+    m := hp.Colormap
+    if m == nil {
+        m = GrayColormap
+    }
+    low, high := hp.Low, hp.High
+    if low >= high {
+        low, high = 0, 1
+    }
+
+    rgba := image.NewRGBA(p.Rect.Dx(), p.Rect.Dy())
+    for i, c := range p.Pix {
+        if IsNotComputed(c.Y) {
+            rgba.Pix[i] = image.RGBAColor{0, 0, 0, 0}
+            continue
+        }
+        y := Float(math.Pow(float64(1.0-c.Y), float64(hp.Gamma)))
+        if !(y >= 0.0) {
+            y = 0.0
+        }
+        if y < hp.Threshold {
+            rgba.Pix[i] = image.RGBAColor{0, 0, 0, 0}
+            continue
+        }
+        rgba.Pix[i] = m.Color((y - low) / (high - low))
+    }
+    return rgba
+}
+
+// Overlay blends foreground over background, two images of the same size,
+// with opacity from 0 for the background alone to 1 for the foreground
+// alone where it is opaque.
+func Overlay(background *image.RGBA, foreground *image.RGBA, opacity Float) *image.RGBA {
+    w, h := background.Rect.Dx(), background.Rect.Dy()
+    out := image.NewRGBA(w, h)
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            b := background.Pix[y*background.Stride+x]
+            f := foreground.Pix[y*foreground.Stride+x]
+            // colors are alpha-premultiplied
+            keep := 1 - opacity*Float(f.A)/255
+            blend := func(b uint8, f uint8) uint8 {
+                return uint8(Float(b)*keep + Float(f)*opacity + 0.5)
+            }
+            out.Pix[y*out.Stride+x] = image.RGBAColor{blend(b.R, f.R), blend(b.G, f.G), blend(b.B, f.B), blend(b.A, f.A)}
+        }
+    }
+    return out
+}
@@ -0,0 +1,69 @@
+package sivq
+
+import (
+    "os"
+    "sync"
+)
+
+// Canceled is returned by Run when its Context was canceled.
+var Canceled = os.NewError("sivq: canceled")
+
+// Context carries a cancellation signal into a SIVQ run.
+type Context interface {
+    // Done returns a channel that is closed when the work should stop.
+    // A nil channel means the work can never be canceled.
+    Done() <-chan bool
+    // Err returns nil while Done is open and the reason for stopping
+    // afterwards.
+    Err() os.Error
+}
+
+type backgroundContext struct{}
+
+func (backgroundContext) Done() <-chan bool { return nil }
+func (backgroundContext) Err() os.Error     { return nil }
+
+// Background returns a Context that is never canceled.
+func Background() Context {
+    return backgroundContext{}
+}
+
+type cancelContext struct {
+    lock sync.Mutex
+    done chan bool
+    err  os.Error
+}
+
+func (c *cancelContext) Done() <-chan bool { return c.done }
+
+func (c *cancelContext) Err() os.Error {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    return c.err
+}
+
+func (c *cancelContext) cancel(err os.Error) {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    if c.err != nil {
+        return
+    }
+    c.err = err
+    close(c.done)
+}
+
+// WithCancel returns a Context that is canceled when the returned function
+// is called or when parent is canceled, whichever happens first.
+func WithCancel(parent Context) (Context, func()) {
+    c := &cancelContext{done: make(chan bool)}
+    if parentDone := parent.Done(); parentDone != nil {
+        go func() {
+            select {
+            case <-parentDone:
+                c.cancel(parent.Err())
+            case <-c.done:
+            }
+        }()
+    }
+    return c, func() { c.cancel(Canceled) }
+}
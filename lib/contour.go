@@ -0,0 +1,328 @@
+package sivq
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "os"
+)
+
+// Vertex is a point of a contour in pixel coordinates, the center of pixel
+// (x, y) being (x+0.5, y+0.5).
+type Vertex struct {
+    X Float
+    Y Float
+}
+
+// Polygon is a matched region bounded by closed rings, the first one
+// being the outer boundary and the rest holes. The last vertex of a ring
+// doesn't repeat the first.
+type Polygon struct {
+    Rings [][]Vertex
+}
+
+// Area returns the area of the polygon in pixels.
+func (pg Polygon) Area() Float {
+    area := Float(0)
+    for i, ring := range pg.Rings {
+        a := signedArea(ring)
+        if a < 0 {
+            a = -a
+        }
+        if i > 0 {
+            a = -a
+        }
+        area += a
+    }
+    return area
+}
+
+// Contours traces the boundaries of the computed pixels with a distance up
+// to threshold with marching squares and simplifies them so that no
+// vertex removed is farther than tolerance from the result.
+func (p *FloatGray) Contours(threshold Float, tolerance Float) []Polygon {
+    w, h := p.Rect.Dx(), p.Rect.Dy()
+    inside := func(x int, y int) bool {
+        if x < 0 || y < 0 || x >= w || y >= h {
+            return false
+        }
+        d := p.Pix[y*p.Stride+x].Y
+        return !IsNotComputed(d) && d <= threshold
+    }
+
+    // crossings are numbered by the grid edge they lie on, the grid
+    // having an outside border of one pixel so that every ring is closed
+    gw := w + 2
+    hKey := func(x int, y int) int { return ((y+1)*gw + x + 1) * 2 }
+    vKey := func(x int, y int) int { return ((y+1)*gw+x+1)*2 + 1 }
+    crossing := func(x0 int, y0 int, x1 int, y1 int) Vertex {
+        // halfway next to the border and pixels not computed
+        f := Float(0.5)
+        if x0 >= 0 && y0 >= 0 && x1 < w && y1 < h {
+            a, b := p.Pix[y0*p.Stride+x0].Y, p.Pix[y1*p.Stride+x1].Y
+            if !IsNotComputed(a) && !IsNotComputed(b) && a != b {
+                f = (threshold - a) / (b - a)
+            }
+        }
+        return Vertex{Float(x0) + f*Float(x1-x0) + 0.5, Float(y0) + f*Float(y1-y0) + 0.5}
+    }
+
+    // segments from the crossing leaving the inside to the next one
+    // entering it clockwise around every cell, so the inside is always
+    // on the same side
+    next := make(map[int]int)
+    vertices := make(map[int]Vertex)
+    for cy := -1; cy < h; cy++ {
+        for cx := -1; cx < w; cx++ {
+            corners := [4][2]int{{cx, cy}, {cx + 1, cy}, {cx + 1, cy + 1}, {cx, cy + 1}}
+            keys := [4]int{hKey(cx, cy), vKey(cx+1, cy), hKey(cx, cy+1), vKey(cx, cy)}
+            var in [4]bool
+            count := 0
+            for i, c := range corners {
+                in[i] = inside(c[0], c[1])
+                if in[i] {
+                    count++
+                }
+            }
+            if count == 0 || count == 4 {
+                continue
+            }
+
+            var exits, entries []int
+            for i := range corners {
+                j := (i + 1) % 4
+                if in[i] == in[j] {
+                    continue
+                }
+                if _, ok := vertices[keys[i]]; !ok {
+                    if i < 2 {
+                        vertices[keys[i]] = crossing(corners[i][0], corners[i][1], corners[j][0], corners[j][1])
+                    } else {
+                        vertices[keys[i]] = crossing(corners[j][0], corners[j][1], corners[i][0], corners[i][1])
+                    }
+                }
+                if in[i] {
+                    exits = append(exits, i)
+                } else {
+                    entries = append(entries, i)
+                }
+            }
+
+            if len(exits) == 1 {
+                next[keys[exits[0]]] = keys[entries[0]]
+                continue
+            }
+            // a saddle is connected through the center if the mean is
+            // inside, its corners being all within the image
+            mean := Float(0)
+            for _, c := range corners {
+                mean += p.Pix[c[1]*p.Stride+c[0]].Y
+            }
+            connected := !IsNotComputed(mean) && mean/4 <= threshold
+            for _, e := range exits {
+                j := (e + 1) % 4 // the next entry clockwise
+                if !connected {
+                    j = (e + 3) % 4 // the previous one
+                }
+                next[keys[e]] = keys[j]
+            }
+        }
+    }
+
+    // follow the segments around every ring
+    var outer, holes [][]Vertex
+    done := make(map[int]bool)
+    for start := range next {
+        if done[start] {
+            continue
+        }
+        var ring []Vertex
+        for key := start; !done[key]; key = next[key] {
+            ring = append(ring, vertices[key])
+            done[key] = true
+        }
+        if signedArea(ring) > 0 {
+            outer = append(outer, ring)
+        } else {
+            holes = append(holes, ring)
+        }
+    }
+
+    // every hole belongs to the smallest outer ring around it
+    polygons := make([]Polygon, len(outer))
+    for i, ring := range outer {
+        polygons[i].Rings = [][]Vertex{ring}
+    }
+    for _, hole := range holes {
+        best, bestArea := -1, Float(0)
+        for i, ring := range outer {
+            a := signedArea(ring)
+            if contains(ring, hole[0]) && (best < 0 || a < bestArea) {
+                best, bestArea = i, a
+            }
+        }
+        if best >= 0 {
+            polygons[best].Rings = append(polygons[best].Rings, hole)
+        }
+    }
+
+    // rings simplified to less than a triangle are dropped with their holes
+    var result []Polygon
+    for _, pg := range polygons {
+        var simplified Polygon
+        for _, ring := range pg.Rings {
+            if ring = simplifyRing(ring, tolerance); len(ring) >= 3 {
+                simplified.Rings = append(simplified.Rings, ring)
+            } else if len(simplified.Rings) == 0 {
+                break
+            }
+        }
+        if len(simplified.Rings) > 0 {
+            result = append(result, simplified)
+        }
+    }
+    return result
+}
+
+// signedArea returns the area of ring, positive for the outer rings of
+// Contours and negative for holes.
+func signedArea(ring []Vertex) Float {
+    a := Float(0)
+    for i, v := range ring {
+        n := ring[(i+1)%len(ring)]
+        a += v.X*n.Y - n.X*v.Y
+    }
+    return a / 2
+}
+
+// contains reports whether v is inside ring.
+func contains(ring []Vertex, v Vertex) bool {
+    in := false
+    for i, a := range ring {
+        b := ring[(i+1)%len(ring)]
+        if (a.Y > v.Y) != (b.Y > v.Y) && v.X < a.X+(v.Y-a.Y)*(b.X-a.X)/(b.Y-a.Y) {
+            in = !in
+        }
+    }
+    return in
+}
+
+// simplifyRing removes vertices of a closed ring with Douglas-Peucker,
+// split at the first vertex and the one farthest from it.
+func simplifyRing(ring []Vertex, tolerance Float) []Vertex {
+    if tolerance <= 0 || len(ring) < 4 {
+        return ring
+    }
+    far, farDistance := 0, Float(-1)
+    for i, v := range ring {
+        dx, dy := v.X-ring[0].X, v.Y-ring[0].Y
+        if d := dx*dx + dy*dy; d > farDistance {
+            far, farDistance = i, d
+        }
+    }
+    closed := append(append([]Vertex{}, ring...), ring[0])
+    first := simplifyLine(closed[:far+1], tolerance)
+    second := simplifyLine(closed[far:], tolerance)
+    return append(first[:len(first)-1], second[:len(second)-1]...)
+}
+
+// simplifyLine keeps the ends of line and the vertices farther than
+// tolerance from the simplified line.
+func simplifyLine(line []Vertex, tolerance Float) []Vertex {
+    if len(line) < 3 {
+        return line
+    }
+    a, b := line[0], line[len(line)-1]
+    dx, dy := b.X-a.X, b.Y-a.Y
+    length := dx*dx + dy*dy
+    far, farDistance := 0, Float(-1)
+    for i := 1; i < len(line)-1; i++ {
+        v := line[i]
+        var d Float
+        if length == 0 {
+            d = (v.X-a.X)*(v.X-a.X) + (v.Y-a.Y)*(v.Y-a.Y)
+        } else {
+            cross := dx*(v.Y-a.Y) - dy*(v.X-a.X)
+            d = cross * cross / length
+        }
+        if d > farDistance {
+            far, farDistance = i, d
+        }
+    }
+    if farDistance <= tolerance*tolerance {
+        return []Vertex{a, b}
+    }
+    first := simplifyLine(line[:far+1], tolerance)
+    return append(first[:len(first)-1], simplifyLine(line[far:], tolerance)...)
+}
+
+// WriteGeoJSON writes the polygons as a FeatureCollection in pixel
+// coordinates with their area as property.
+func WriteGeoJSON(w io.Writer, polygons []Polygon) os.Error {
+    var buf bytes.Buffer
+    buf.WriteString(`{"type":"FeatureCollection","features":[`)
+    for i, pg := range polygons {
+        if i > 0 {
+            buf.WriteString(",")
+        }
+        buf.WriteString(`{"type":"Feature","geometry":{"type":"Polygon","coordinates":[`)
+        for j, ring := range pg.Rings {
+            if j > 0 {
+                buf.WriteString(",")
+            }
+            // GeoJSON rings end with their first position
+            buf.WriteString("[")
+            for _, v := range ring {
+                fmt.Fprintf(&buf, "[%g,%g],", v.X, v.Y)
+            }
+            fmt.Fprintf(&buf, "[%g,%g]]", ring[0].X, ring[0].Y)
+        }
+        fmt.Fprintf(&buf, `]},"properties":{"area":%g}}`, pg.Area())
+    }
+    buf.WriteString("]}\n")
+    _, err := w.Write(buf.Bytes())
+    return err
+}
+
+// WriteSVG writes the polygons as a path of size width x height over the
+// image at href, if any.
+func WriteSVG(w io.Writer, polygons []Polygon, href string, width int, height int) os.Error {
+    var buf bytes.Buffer
+    fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" `+
+        `width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", width, height, width, height)
+    if href != "" {
+        fmt.Fprintf(&buf, `<image xlink:href="%s" x="0" y="0" width="%d" height="%d" />`+"\n",
+            escapeXML(href), width, height)
+    }
+    buf.WriteString(`<path fill="red" fill-opacity="0.3" fill-rule="evenodd" stroke="red" d="`)
+    for _, pg := range polygons {
+        for _, ring := range pg.Rings {
+            fmt.Fprintf(&buf, "M%g %g", ring[0].X, ring[0].Y)
+            for _, v := range ring[1:] {
+                fmt.Fprintf(&buf, " %g %g", v.X, v.Y)
+            }
+            buf.WriteString("Z")
+        }
+    }
+    buf.WriteString("\" />\n</svg>\n")
+    _, err := w.Write(buf.Bytes())
+    return err
+}
+
+// escapeXML escapes the characters of s that are special in attributes.
+func escapeXML(s string) string {
+    escaped := ""
+    for i := 0; i < len(s); i++ {
+        switch s[i] {
+        case '&':
+            escaped += "&amp;"
+        case '<':
+            escaped += "&lt;"
+        case '"':
+            escaped += "&quot;"
+        default:
+            escaped += s[i : i+1]
+        }
+    }
+    return escaped
+}
@@ -0,0 +1,81 @@
+package sivq
+
+import (
+    "testing"
+)
+
+func TestContours(t *testing.T) {
+    nc := NotComputed()
+    tests := []struct {
+        name      string
+        distances *FloatGray
+        threshold Float
+        rings     []int // rings of every polygon
+        area      Float // of all polygons
+    }{
+        {"single pixel", grayImage(
+            []Float{1, 1, 1},
+            []Float{1, 0, 1},
+            []Float{1, 1, 1}), 0.5, []int{1}, 0.5},
+        {"hole", grayImage(
+            []Float{1, 1, 1, 1, 1},
+            []Float{1, 0, 0, 0, 1},
+            []Float{1, 0, 1, 0, 1},
+            []Float{1, 0, 0, 0, 1},
+            []Float{1, 1, 1, 1, 1}), 0.5, []int{2}, 8.5 - 0.5},
+        // the mean of the saddle cell decides whether the diagonal connects
+        {"saddle connected", grayImage(
+            []Float{1, 1, 1, 1},
+            []Float{1, 0.2, 0.6, 1},
+            []Float{1, 0.6, 0.2, 1},
+            []Float{1, 1, 1, 1}), 0.45, []int{1}, -1},
+        {"saddle separated", grayImage(
+            []Float{1, 1, 1, 1},
+            []Float{1, 0.2, 0.6, 1},
+            []Float{1, 0.6, 0.2, 1},
+            []Float{1, 1, 1, 1}), 0.3, []int{1, 1}, -1},
+        {"uncomputed", grayImage(
+            []Float{1, 1, 1},
+            []Float{1, nc, 1},
+            []Float{1, 1, 1}), 0.5, []int{}, 0},
+        {"image border", grayImage(
+            []Float{0, 0},
+            []Float{0, 0}), 0.5, []int{1}, 4 - 4*0.125},
+    }
+    for _, test := range tests {
+        polygons := test.distances.Contours(test.threshold, 0)
+        ok := len(polygons) == len(test.rings)
+        area := Float(0)
+        for i := 0; ok && i < len(polygons); i++ {
+            ok = len(polygons[i].Rings) == test.rings[i]
+            area += polygons[i].Area()
+        }
+        if !ok {
+            t.Errorf("%s: polygons %v, want rings %v", test.name, polygons, test.rings)
+        } else if test.area >= 0 && !near(area, test.area) {
+            t.Errorf("%s: area %g, want %g", test.name, area, test.area)
+        }
+    }
+}
+
+func TestContoursSimplify(t *testing.T) {
+    distances := NewFloatGray(12, 12)
+    for y := 0; y < 12; y++ {
+        for x := 0; x < 12; x++ {
+            dx, dy := Float(x)-5.5, Float(y)-5.5
+            distances.Pix[y*distances.Stride+x].Y = (dx*dx + dy*dy) / 50
+        }
+    }
+    exact := distances.Contours(0.5, 0)
+    simplified := distances.Contours(0.5, 0.5)
+    if len(exact) != 1 || len(simplified) != 1 {
+        t.Fatalf("%d and %d polygons, want 1", len(exact), len(simplified))
+    }
+    n, m := len(exact[0].Rings[0]), len(simplified[0].Rings[0])
+    if m >= n || m < 4 {
+        t.Errorf("simplified to %d of %d vertices", m, n)
+    }
+    if a, b := exact[0].Area(), simplified[0].Area(); b > a || b < a*0.9 {
+        t.Errorf("simplified area %g, exact %g", b, a)
+    }
+}
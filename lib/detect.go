@@ -0,0 +1,105 @@
+package sivq
+
+import (
+    "fmt"
+    "image"
+    "io"
+    "os"
+    "sort"
+)
+
+// Detection is a best match in its neighbourhood of a distance map.
+type Detection struct {
+    X        int
+    Y        int
+    Distance Float // distance of the match, 0.0 being perfect
+    Rotation Float // best rotation in radians, 0 without the rotation map
+    Label    int   // index of the best vector of RunVectors, 0 otherwise
+}
+
+type detections []Detection
+
+func (d detections) Len() int           { return len(d) }
+func (d detections) Less(i, j int) bool { return d[i].Distance < d[j].Distance }
+func (d detections) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// Detect finds the local minima of the distance map up to threshold and
+// keeps only the best one within radius of each other, usually the
+// MaxRadius of the vector. Detections are returned from the best match.
+func (r *Result) Detect(threshold Float, radius int) []Detection {
+    m := r.Distance
+    w, h := m.Rect.Dx(), m.Rect.Dy()
+
+    // local minima, a plateau keeps its first pixel
+    var candidates detections
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            d := m.Pix[y*m.Stride+x].Y
+            if IsNotComputed(d) || d > threshold || !localMinimum(m, x, y) {
+                continue
+            }
+            detection := Detection{X: x, Y: y, Distance: d}
+            if r.Rotation != nil {
+                detection.Rotation = r.Rotation.Pix[y*r.Rotation.Stride+x].Y
+            }
+            if r.Label != nil {
+                detection.Label = int(r.Label.Pix[y*r.Label.Stride+x].Y)
+            }
+            candidates = append(candidates, detection)
+        }
+    }
+    sort.Stable(candidates)
+
+    // non-maximum suppression from the best match
+    var result []Detection
+    suppressed := make([]bool, w*h)
+    for _, c := range candidates {
+        if suppressed[c.Y*w+c.X] {
+            continue
+        }
+        result = append(result, c)
+        for y := c.Y - radius; y <= c.Y+radius; y++ {
+            for x := c.X - radius; x <= c.X+radius; x++ {
+                dx, dy := x-c.X, y-c.Y
+                if x >= 0 && y >= 0 && x < w && y < h && dx*dx+dy*dy <= radius*radius {
+                    suppressed[y*w+x] = true
+                }
+            }
+        }
+    }
+    return result
+}
+
+// localMinimum reports whether the distance at x, y is smaller than that of
+// its 8 neighbours, or equal to those that come after it in the image.
+func localMinimum(m *FloatGray, x int, y int) bool {
+    d := m.Pix[y*m.Stride+x].Y
+    for ny := y - 1; ny <= y+1; ny++ {
+        for nx := x - 1; nx <= x+1; nx++ {
+            if (nx == x && ny == y) || !m.Rect.Contains(image.Point{nx, ny}) {
+                continue
+            }
+            n := m.Pix[ny*m.Stride+nx].Y
+            if IsNotComputed(n) {
+                continue
+            }
+            if n < d || (n == d && (ny < y || ny == y && nx < x)) {
+                return false
+            }
+        }
+    }
+    return true
+}
+
+// WriteDetectionsCSV writes one detection per line.
+func WriteDetectionsCSV(w io.Writer, detections []Detection) os.Error {
+    if _, err := fmt.Fprintln(w, "x,y,distance,rotation,label"); err != nil {
+        return err
+    }
+    for _, d := range detections {
+        if _, err := fmt.Fprintf(w, "%d,%d,%g,%g,%d\n", d.X, d.Y, d.Distance, d.Rotation, d.Label); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,62 @@
+package sivq
+
+import (
+    "testing"
+)
+
+type minimum struct {
+    x, y int
+    d    Float
+}
+
+// peaks returns a w x h distance map of 1 with the given minima.
+func peaks(w int, h int, minima []minimum) *FloatGray {
+    m := NewFloatGray(w, h)
+    for i := range m.Pix {
+        m.Pix[i].Y = 1
+    }
+    for _, pt := range minima {
+        m.Pix[pt.y*m.Stride+pt.x].Y = pt.d
+    }
+    return m
+}
+
+func TestDetect(t *testing.T) {
+    tests := []struct {
+        name      string
+        minima    []minimum
+        threshold Float
+        radius    int
+        want      [][2]int // from the best match
+    }{
+        {"apart", []minimum{{3, 5, 0.2}, {8, 5, 0.1}}, 0.5, 4, [][2]int{{8, 5}, {3, 5}}},
+        {"at the radius", []minimum{{3, 5, 0.2}, {6, 5, 0.1}}, 0.5, 3, [][2]int{{6, 5}}},
+        {"beyond the radius", []minimum{{3, 5, 0.2}, {6, 5, 0.1}}, 0.5, 2, [][2]int{{6, 5}, {3, 5}}},
+        {"diagonal", []minimum{{3, 3, 0.1}, {5, 5, 0.2}}, 0.5, 2, [][2]int{{3, 3}, {5, 5}}},
+        {"above threshold", []minimum{{3, 5, 0.2}, {8, 5, 0.6}}, 0.5, 1, [][2]int{{3, 5}}},
+        {"plateau", []minimum{{4, 4, 0.3}, {5, 4, 0.3}, {4, 5, 0.3}}, 0.5, 0, [][2]int{{4, 4}}},
+    }
+    for _, test := range tests {
+        r := &Result{Distance: peaks(12, 10, test.minima)}
+        detections := r.Detect(test.threshold, test.radius)
+        ok := len(detections) == len(test.want)
+        for i := 0; ok && i < len(detections); i++ {
+            ok = detections[i].X == test.want[i][0] && detections[i].Y == test.want[i][1]
+        }
+        if !ok {
+            t.Errorf("%s: detections %v, want %v", test.name, detections, test.want)
+        }
+    }
+}
+
+func TestDetectRotationAndLabel(t *testing.T) {
+    r := &Result{Distance: peaks(5, 5, []minimum{{2, 2, 0.1}})}
+    r.Rotation = NewFloatGray(5, 5)
+    r.Rotation.Pix[2*5+2].Y = 1.5
+    r.Label = NewFloatGray(5, 5)
+    r.Label.Pix[2*5+2].Y = 3
+    detections := r.Detect(0.5, 1)
+    if len(detections) != 1 || detections[0].Rotation != 1.5 || detections[0].Label != 3 {
+        t.Errorf("detections %v, want one with rotation 1.5 and label 3", detections)
+    }
+}
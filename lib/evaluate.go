@@ -0,0 +1,209 @@
+package sivq
+
+import (
+    "fmt"
+    "image"
+    "io"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// CurvePoints is the most points Evaluate keeps of the ROC and
+// precision/recall curves.
+const CurvePoints = 256
+
+// CurvePoint is the classification of a distance map when all pixels with a
+// distance up to Threshold are predicted positive.
+type CurvePoint struct {
+    Threshold      Float
+    TruePositives  int
+    FalsePositives int
+    TrueNegatives  int
+    FalseNegatives int
+    TPR            Float // true positive rate, also the recall
+    FPR            Float // false positive rate
+    Precision      Float
+    F1             Float // equal to the Dice coefficient of the prediction
+}
+
+// Evaluation measures how well a distance map separates the positive
+// pixels of a ground truth from the negative ones.
+type Evaluation struct {
+    Positives        int
+    Negatives        int
+    AUC              Float        // area under the ROC curve
+    AveragePrecision Float        // area under the precision/recall curve
+    Best             CurvePoint   // the threshold with the highest F1
+    Threshold        Float        // the threshold Dice was evaluated at
+    Dice             Float        // Dice coefficient at Threshold
+    Curve            []CurvePoint // by increasing threshold
+}
+
+// scoredPixel is a computed distance and whether the truth is positive.
+type scoredPixel struct {
+    distance Float
+    positive bool
+}
+
+type scoredPixels []scoredPixel
+
+func (s scoredPixels) Len() int           { return len(s) }
+func (s scoredPixels) Less(i, j int) bool { return s[i].distance < s[j].distance }
+func (s scoredPixels) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// NewMask converts m into a ground truth where bright pixels, with a
+// gray value of at least 0.5, are positive.
+func NewMask(m image.Image) *FloatGray {
+    b := m.Bounds()
+    mask := NewFloatGray(b.Dx(), b.Dy())
+    for y := 0; y < b.Dy(); y++ {
+        for x := 0; x < b.Dx(); x++ {
+            if toFloatGrayColor(m.At(b.Min.X+x, b.Min.Y+y)).(FloatGrayColor).Y >= 0.5 {
+                mask.Pix[y*mask.Stride+x].Y = 1
+            }
+        }
+    }
+    return mask
+}
+
+// ParsePoints parses comma separated points such as "10:20,30:40".
+func ParsePoints(s string) ([]image.Point, os.Error) {
+    fields := strings.Fields(strings.Replace(s, ",", " ", -1))
+    points := make([]image.Point, len(fields))
+    for i, field := range fields {
+        colon := strings.Index(field, ":")
+        if colon < 0 {
+            return nil, os.NewError("sivq: invalid point " + field)
+        }
+        x, err := strconv.Atoi(field[:colon])
+        if err != nil {
+            return nil, err
+        }
+        y, err := strconv.Atoi(field[colon+1:])
+        if err != nil {
+            return nil, err
+        }
+        points[i] = image.Point{x, y}
+    }
+    return points, nil
+}
+
+// PointMask returns a w x h ground truth where the pixels within radius of
+// an annotated point are positive.
+func PointMask(w int, h int, points []image.Point, radius int) *FloatGray {
+    mask := NewFloatGray(w, h)
+    for _, pt := range points {
+        for y := pt.Y - radius; y <= pt.Y+radius; y++ {
+            for x := pt.X - radius; x <= pt.X+radius; x++ {
+                dx, dy := x-pt.X, y-pt.Y
+                if dx*dx+dy*dy <= radius*radius {
+                    mask.SetFloatGray(x, y, FloatGrayColor{1})
+                }
+            }
+        }
+    }
+    return mask
+}
+
+// Evaluate compares the distance map with the ground truth mask, where
+// values above 0.5 are positive, over the computed pixels of distances.
+// Dice is evaluated at threshold.
+func Evaluate(distances *FloatGray, truth *FloatGray, threshold Float) (*Evaluation, os.Error) {
+    if !distances.Rect.Eq(truth.Rect) {
+        return nil, os.NewError("sivq: ground truth and distance map sizes differ")
+    }
+
+    e := &Evaluation{Threshold: threshold}
+    pixels := make(scoredPixels, 0, len(distances.Pix))
+    for i, c := range distances.Pix {
+        if IsNotComputed(c.Y) {
+            continue
+        }
+        positive := truth.Pix[i].Y > 0.5
+        if positive {
+            e.Positives++
+        } else {
+            e.Negatives++
+        }
+        pixels = append(pixels, scoredPixel{c.Y, positive})
+    }
+    if e.Positives == 0 || e.Negatives == 0 {
+        return nil, os.NewError("sivq: ground truth needs positive and negative pixels")
+    }
+    sort.Sort(pixels)
+
+    // sweep the threshold over every distinct distance
+    var all []CurvePoint
+    previous := e.point(-1, 0, 0)
+    dice := previous
+    for i := 0; i < len(pixels); {
+        t := pixels[i].distance
+        tp, fp := previous.TruePositives, previous.FalsePositives
+        for ; i < len(pixels) && pixels[i].distance == t; i++ {
+            if pixels[i].positive {
+                tp++
+            } else {
+                fp++
+            }
+        }
+        pt := e.point(t, tp, fp)
+        e.AUC += (pt.FPR - previous.FPR) * (pt.TPR + previous.TPR) / 2
+        e.AveragePrecision += (pt.TPR - previous.TPR) * pt.Precision
+        if pt.F1 > e.Best.F1 {
+            e.Best = pt
+        }
+        if t <= threshold {
+            dice = pt
+        }
+        all = append(all, pt)
+        previous = pt
+    }
+    e.Dice = dice.F1
+
+    // keep evenly spaced points including the first and the last one
+    e.Curve = all
+    if len(all) > CurvePoints {
+        e.Curve = make([]CurvePoint, CurvePoints)
+        for i := range e.Curve {
+            e.Curve[i] = all[i*(len(all)-1)/(CurvePoints-1)]
+        }
+    }
+    return e, nil
+}
+
+// point returns the curve point with tp true and fp false positives.
+func (e *Evaluation) point(threshold Float, tp int, fp int) CurvePoint {
+    pt := CurvePoint{
+        Threshold:      threshold,
+        TruePositives:  tp,
+        FalsePositives: fp,
+        TrueNegatives:  e.Negatives - fp,
+        FalseNegatives: e.Positives - tp}
+    pt.TPR = Float(tp) / Float(e.Positives)
+    pt.FPR = Float(fp) / Float(e.Negatives)
+    if tp+fp > 0 {
+        pt.Precision = Float(tp) / Float(tp+fp)
+    } else {
+        pt.Precision = 1
+    }
+    pt.F1 = 2 * Float(tp) / Float(2*tp+fp+e.Positives-tp)
+    return pt
+}
+
+// WriteCSV writes the curve with one threshold per line.
+func (e *Evaluation) WriteCSV(w io.Writer) os.Error {
+    if _, err := fmt.Fprintln(w, "threshold,tp,fp,tn,fn,tpr,fpr,precision,f1"); err != nil {
+        return err
+    }
+    for _, pt := range e.Curve {
+        _, err := fmt.Fprintf(w, "%g,%d,%d,%d,%d,%g,%g,%g,%g\n", pt.Threshold,
+            pt.TruePositives, pt.FalsePositives, pt.TrueNegatives, pt.FalseNegatives,
+            pt.TPR, pt.FPR, pt.Precision, pt.F1)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
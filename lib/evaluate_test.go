@@ -0,0 +1,72 @@
+package sivq
+
+import (
+    "testing"
+)
+
+// grayImage returns a FloatGray with the given rows of values.
+func grayImage(rows ...[]Float) *FloatGray {
+    m := NewFloatGray(len(rows[0]), len(rows))
+    for y, row := range rows {
+        for x, v := range row {
+            m.Pix[y*m.Stride+x].Y = v
+        }
+    }
+    return m
+}
+
+func near(a Float, b Float) bool {
+    return a-b < 1e-5 && b-a < 1e-5
+}
+
+func TestEvaluate(t *testing.T) {
+    truth := grayImage([]Float{1, 1, 0, 0})
+    tests := []struct {
+        name      string
+        distances []Float
+        auc, ap   Float
+        best      Float // F1 at the best threshold
+        dice      Float // at a threshold of 0.5
+    }{
+        {"separable", []Float{0.1, 0.2, 0.8, 0.9}, 1, 1, 1, 1},
+        {"inverted", []Float{0.9, 0.8, 0.2, 0.1}, 0, 0.5/3 + 0.5/2, 2.0 / 3, 0},
+        {"constant", []Float{0.5, 0.5, 0.5, 0.5}, 0.5, 0.5, 2.0 / 3, 2.0 / 3},
+    }
+    for _, test := range tests {
+        e, err := Evaluate(grayImage(test.distances), truth, 0.5)
+        if err != nil {
+            t.Errorf("%s: %s", test.name, err)
+            continue
+        }
+        if e.Positives != 2 || e.Negatives != 2 {
+            t.Errorf("%s: %d positives and %d negatives, want 2 and 2", test.name, e.Positives, e.Negatives)
+        }
+        if !near(e.AUC, test.auc) || !near(e.AveragePrecision, test.ap) {
+            t.Errorf("%s: AUC %g AP %g, want %g and %g", test.name, e.AUC, e.AveragePrecision, test.auc, test.ap)
+        }
+        if !near(e.Best.F1, test.best) || !near(e.Dice, test.dice) {
+            t.Errorf("%s: best F1 %g Dice %g, want %g and %g", test.name, e.Best.F1, e.Dice, test.best, test.dice)
+        }
+    }
+}
+
+func TestEvaluateSkipsUncomputed(t *testing.T) {
+    distances := grayImage([]Float{0.1, NotComputed(), 0.8, 0.9})
+    e, err := Evaluate(distances, grayImage([]Float{1, 1, 0, 0}), 0.5)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if e.Positives != 1 || !near(e.AUC, 1) {
+        t.Errorf("%d positives and AUC %g, want 1 and 1", e.Positives, e.AUC)
+    }
+}
+
+func TestEvaluateErrors(t *testing.T) {
+    distances := grayImage([]Float{0.1, 0.2})
+    if _, err := Evaluate(distances, grayImage([]Float{1, 1}), 0.5); err == nil {
+        t.Error("no error without negatives")
+    }
+    if _, err := Evaluate(distances, grayImage([]Float{1, 0, 0}), 0.5); err == nil {
+        t.Error("no error for different sizes")
+    }
+}
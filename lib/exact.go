@@ -0,0 +1,181 @@
+package sivq
+
+import (
+    "math"
+    "sort"
+)
+
+// exactRing holds the precomputed spectra of one ring of the reference
+// vector. The distance of the ring to a sampled ring for every cyclic shift
+// is the circular cross-correlation of the two, which is calculated with an
+// FFT of length size.
+type exactRing struct {
+    size     int          // FFT length, at least twice the data length
+    count    int          // number of values in the ring
+    stride   int          // values per pixel
+    pixels   int          // number of pixels in the ring
+    sumA2    float64      // sum of the squared compared reference values
+    compared int          // number of compared values
+    mask     []complex128 // conjugated spectrum of the comparison mask
+    masked   []complex128 // conjugated spectrum of the masked reference
+}
+
+// rotationEvent is a rotation angle at which one ring moves on by a pixel.
+type rotationEvent struct {
+    ring   int
+    step   int  // the ring moves to its step-th pixel
+    pixels int  // pixels in the ring
+    last   bool // no other event has the same angle
+}
+
+type rotationEvents []rotationEvent
+
+func (e rotationEvents) Len() int      { return len(e) }
+func (e rotationEvents) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e rotationEvents) Less(i, j int) bool {
+    return e[i].step*e[j].pixels < e[j].step*e[i].pixels
+}
+
+// exactMatcher compares ring vectors against a reference for all rotations
+// at once. It is immutable after creation and can be shared by goroutines,
+// each of which needs its own exactBuffer.
+type exactMatcher struct {
+    rings    []exactRing
+    events   rotationEvents
+    compared int
+}
+
+// exactBuffer is the per goroutine scratch space of an exactMatcher.
+type exactBuffer struct {
+    spectrum []complex128
+    dists    [][]float64
+}
+
+func newExactMatcher(A *RingVector, p SIVQParameters) *exactMatcher {
+    matchStride := p.MatchingStride
+    if matchStride <= 0 {
+        matchStride = 1
+    }
+
+    m := &exactMatcher{rings: make([]exactRing, len(A.Rings))}
+    for ri, ring := range A.Rings {
+        er := &m.rings[ri]
+        er.count = len(ring.Data)
+        er.stride = ring.Stride
+        er.pixels = er.count / er.stride
+        er.size = nextPowerOfTwo(2 * er.count)
+        er.mask = make([]complex128, er.size)
+        er.masked = make([]complex128, er.size)
+
+        for i := p.MatchingOffset; i < er.count; i += matchStride {
+            a := float64(ring.Data[i])
+            er.mask[i] = complex(1, 0)
+            er.masked[i] = complex(a, 0)
+            er.sumA2 += a * a
+            er.compared += 1
+        }
+        m.compared += er.compared
+
+        fft(er.mask, false)
+        fft(er.masked, false)
+        for k := range er.mask {
+            er.mask[k] = complex(real(er.mask[k]), -imag(er.mask[k]))
+            er.masked[k] = complex(real(er.masked[k]), -imag(er.masked[k]))
+        }
+
+        for step := 1; step < er.pixels; step++ {
+            m.events = append(m.events, rotationEvent{ring: ri, step: step, pixels: er.pixels})
+        }
+    }
+
+    sort.Sort(m.events)
+    for i := range m.events {
+        if i+1 == len(m.events) || m.events.Less(i, i+1) {
+            m.events[i].last = true
+        }
+    }
+    return m
+}
+
+func (m *exactMatcher) newBuffer() *exactBuffer {
+    buf := &exactBuffer{
+        dists: make([][]float64, len(m.rings))}
+    size := 0
+    for ri, er := range m.rings {
+        buf.dists[ri] = make([]float64, er.pixels)
+        if er.size > size {
+            size = er.size
+        }
+    }
+    buf.spectrum = make([]complex128, size)
+    return buf
+}
+
+// ringDistances stores the sum of squared differences between the ring of
+// B and the reference ring for every pixel shift into dists.
+func (er *exactRing) ringDistances(data []Float, z []complex128, dists []float64) {
+    // pack the ring repeated twice and its square into one complex signal
+    for i := range z {
+        if i < 2*er.count {
+            v := float64(data[i%er.count])
+            z[i] = complex(v, v*v)
+        } else {
+            z[i] = 0
+        }
+    }
+    fft(z, false)
+
+    // separate the spectra of both real signals and correlate them
+    n := er.size
+    for k := 0; k <= n/2; k++ {
+        nk := (n - k) % n
+        zk, zn := z[k], z[nk]
+        czk := complex(real(zk), -imag(zk))
+        czn := complex(real(zn), -imag(zn))
+
+        values := (zk + czn) / 2
+        squares := (zk - czn) / complex(0, 2)
+        outK := er.mask[k]*squares - 2*er.masked[k]*values
+
+        values = (zn + czk) / 2
+        squares = (zn - czk) / complex(0, 2)
+        outN := er.mask[nk]*squares - 2*er.masked[nk]*values
+
+        z[k], z[nk] = outK, outN
+    }
+    fft(z, true)
+
+    for j := range dists {
+        d := real(z[j*er.stride]) + er.sumA2
+        if d < 0 {
+            d = 0
+        }
+        dists[j] = d
+    }
+}
+
+// diff returns the root mean squared difference of B to the reference for
+// the best of all rotations and the smallest rotation angle giving it.
+func (m *exactMatcher) diff(B *RingVector, buf *exactBuffer) (Float, Float) {
+    total := 0.0
+    for ri := range m.rings {
+        er := &m.rings[ri]
+        er.ringDistances(B.Rings[ri].Data, buf.spectrum[:er.size], buf.dists[ri])
+        total += buf.dists[ri][0]
+    }
+
+    best := total
+    rotation := Float(0)
+    for _, e := range m.events {
+        dists := buf.dists[e.ring]
+        total += dists[e.step] - dists[e.step-1]
+        if e.last && total < best {
+            best = total
+            rotation = Tau * Float(e.step) / Float(e.pixels)
+        }
+    }
+    if best < 0 {
+        best = 0
+    }
+    return Float(math.Sqrt(best / float64(m.compared))), rotation
+}
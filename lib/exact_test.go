@@ -0,0 +1,66 @@
+package sivq
+
+import (
+    "image"
+    "testing"
+)
+
+// testImage returns a w x h image of deterministic noise.
+func testImage(w int, h int) *image.RGBA {
+    m := image.NewRGBA(w, h)
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            v := x*37 + y*91 + x*y*13
+            m.Pix[y*m.Stride+x] = image.RGBAColor{uint8(v), uint8(v * 7 / 3), uint8(v * 11 / 5), 255}
+        }
+    }
+    return m
+}
+
+// exactAndStepped compares the vector at the center of a noise image
+// against the pixels around it with the exact search and the stepped one at
+// a stride of one sample of the largest ring.
+func exactAndStepped(t *testing.T, rvp RingVectorParameters, check func(x, y int, exact, stepped Float)) {
+    input := testImage(32, 32)
+    A := NewRingVector(rvp)
+    A.LoadData(input, 16, 16)
+
+    largest := A.Rings[len(A.Rings)-1]
+    stepped := SIVQParameters{RotationStride: Tau * Float(largest.Stride) / Float(len(largest.Data)), MatchingStride: 1}
+    exact := SIVQParameters{ExactRotation: true, MatchingStride: 1}
+    for y := 12; y <= 20; y++ {
+        for x := 12; x <= 20; x++ {
+            B := NewRingVector(rvp)
+            B.LoadData(input, x, y)
+            check(x, y, A.Diff(B, exact), A.Diff(B, stepped))
+        }
+    }
+}
+
+func TestExactMatchesSteppedOneRing(t *testing.T) {
+    rvp := RingVectorParameters{Radius: 5, Count: 1, RadiusInc: 1}
+    exactAndStepped(t, rvp, func(x, y int, exact, stepped Float) {
+        if d := exact - stepped; d > 1e-4 || d < -1e-4 {
+            t.Errorf("at %d,%d exact distance %g, stepped %g", x, y, exact, stepped)
+        }
+    })
+}
+
+func TestExactNotWorseThanStepped(t *testing.T) {
+    // the exact search also compares the angles where only inner rings move
+    rvp := RingVectorParameters{Radius: 3, Count: 3, RadiusInc: 2}
+    exactAndStepped(t, rvp, func(x, y int, exact, stepped Float) {
+        if exact > stepped+1e-4 {
+            t.Errorf("at %d,%d exact distance %g above stepped %g", x, y, exact, stepped)
+        }
+    })
+}
+
+func TestExactRejectsOtherMetrics(t *testing.T) {
+    input := testImage(16, 16)
+    rv := NewRingVector(RingVectorParameters{Radius: 3, Count: 1, RadiusInc: 1})
+    rv.LoadData(input, 8, 8)
+    if _, err := Run(Background(), SIVQParameters{ExactRotation: true, Metric: L1}, input, rv); err == nil {
+        t.Error("exact rotation with the l1 metric ran")
+    }
+}
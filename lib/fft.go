@@ -0,0 +1,59 @@
+package sivq
+
+import (
+    "math"
+)
+
+// nextPowerOfTwo returns the smallest power of two that is >= n.
+func nextPowerOfTwo(n int) int {
+    size := 1
+    for size < n {
+        size <<= 1
+    }
+    return size
+}
+
+// fft calculates the discrete Fourier transform of a in place. The length
+// of a must be a power of two. With inverse the inverse transform is
+// calculated, including the 1/len(a) scaling.
+func fft(a []complex128, inverse bool) {
+    n := len(a)
+
+    // bit reversal permutation
+    for i, j := 1, 0; i < n; i++ {
+        bit := n >> 1
+        for ; j&bit != 0; bit >>= 1 {
+            j ^= bit
+        }
+        j ^= bit
+        if i < j {
+            a[i], a[j] = a[j], a[i]
+        }
+    }
+
+    for length := 2; length <= n; length <<= 1 {
+        angle := 2 * math.Pi / float64(length)
+        if !inverse {
+            angle = -angle
+        }
+        wl := complex(math.Cos(angle), math.Sin(angle))
+        half := length >> 1
+        for i := 0; i < n; i += length {
+            w := complex(1, 0)
+            for j := 0; j < half; j++ {
+                u := a[i+j]
+                v := a[i+j+half] * w
+                a[i+j] = u + v
+                a[i+j+half] = u - v
+                w *= wl
+            }
+        }
+    }
+
+    if inverse {
+        scale := complex(1/float64(n), 0)
+        for i := range a {
+            a[i] *= scale
+        }
+    }
+}
@@ -0,0 +1,208 @@
+package sivq
+
+import (
+    "image"
+    "math"
+)
+
+
+type FloatGrayColor struct {
+    Y Float
+}
+
+func (c FloatGrayColor) RGBA() (r,g,b,a uint32) {
+    var y uint32
+    if IsNotComputed(c.Y) {
+        return 0, 0, 0, 0
+    } else if c.Y > 1.0 {
+        y = 0xffff
+    } else if c.Y < 0.0 {
+        y = 0
+    } else {
+        y = (uint32)(c.Y * 0xffff)
+    }
+    return y, y, y, 0xffff
+}
+
+func toFloatGrayColor(c image.Color) image.Color {
+    if _, ok := c.(FloatGrayColor); ok {
+        return c
+    }
+    r, g, b, _ := c.RGBA()
+    y :=  (0.3*Float(r) + 0.59*Float(g) + 0.11*Float(b)) / Float(0xffff)
+    return FloatGrayColor{ y }
+}
+
+var FloatGrayColorModel image.ColorModel = image.ColorModelFunc(toFloatGrayColor)
+
+type FloatGray struct {
+    Pix     []FloatGrayColor
+    Stride  int
+    Rect    image.Rectangle
+}
+
+func (p *FloatGray) ColorModel() image.ColorModel { return FloatGrayColorModel }
+
+func (p *FloatGray) Bounds() image.Rectangle { return p.Rect }
+
+func (p *FloatGray) At(x, y int) image.Color {
+    if !p.Rect.Contains(image.Point{x, y}) {
+        return FloatGrayColor{}
+    }
+    return p.Pix[y*p.Stride+x]
+}
+
+func (p *FloatGray) AtFast(x, y int) image.Color{
+    return p.Pix[y*p.Stride+x]
+}
+
+func (p *FloatGray) Set(x, y int, c image.Color) {
+    if !p.Rect.Contains(image.Point{x, y}) {
+        return
+    }
+    p.Pix[y*p.Stride+x] = toFloatGrayColor(c).(FloatGrayColor)
+}
+
+func (p *FloatGray) SetFloatGray(x, y int, c FloatGrayColor) {
+    if !p.Rect.Contains(image.Point{x, y}) {
+        return
+    }
+    p.Pix[y*p.Stride+x] = c
+}
+
+// Opaque scans the entire image and returns whether or not it is fully opaque.
+func (p *FloatGray) Opaque() bool {
+    for _, c := range p.Pix {
+        if IsNotComputed(c.Y) {
+            return false
+        }
+    }
+    return true
+}
+
+func (p *FloatGray) ToRGBA(gamma Float, threshold Float) * image.RGBA {
+    rgba := image.NewRGBA(p.Rect.Dx(), p.Rect.Dy())
+    if threshold < 0.0 {
+        threshold = 0.0
+    }
+
+    for i, c := range p.Pix {
+        if IsNotComputed(c.Y) {
+            rgba.Pix[i] = image.RGBAColor{0, 0, 0, 0}
+            continue
+        }
+        // some metrics and channels give distances above 1
+        d := c.Y
+        if d > 1.0 {
+            d = 1.0
+        }
+        y := Float(math.Pow(float64(1.0 - d), float64(gamma)))
+        
+        if y < threshold {
+            y = 0
+        } else if y > 1.0 {
+            y = 1.0
+        }
+        
+        v := uint8(y * 255.0)
+        rgba.Pix[i] = image.RGBAColor{v, v, v, 255}
+    }
+    return rgba
+}
+
+// DistanceThreshold returns the largest distance ToRGBA draws with gamma
+// and threshold, infinity for a threshold of 0 that draws every distance,
+// even those above 1.
+func DistanceThreshold(gamma Float, threshold Float) Float {
+    if threshold <= 0.0 {
+        return Float(math.Inf(1))
+    }
+    return 1.0 - Float(math.Pow(float64(threshold), 1.0/float64(gamma)))
+}
+
+// DisplayThreshold returns the threshold for ToRGBA with gamma that draws
+// the distances up to distance.
+func DisplayThreshold(gamma Float, distance Float) Float {
+    if distance >= 1.0 {
+        return 0.0
+    } else if distance <= 0.0 {
+        return 1.0
+    }
+    return Float(math.Pow(float64(1.0-distance), float64(gamma)))
+}
+
+// NewGray16 returns a new Gray16 with the given width and height.
+func NewFloatGray(w, h int) *FloatGray {
+    pix := make([]FloatGrayColor, w*h)
+    return &FloatGray{pix, w, image.Rectangle{image.ZP, image.Point{w, h}}}
+}
+
+// OrientationRGBA renders the Rotation of r with the angle as hue and the
+// match strength, the distance with gamma applied as in ToRGBA, as value.
+// Pixels that were not computed are transparent. r must have been computed
+// with SIVQParameters.Orientation.
+func (r *Result) OrientationRGBA(gamma Float) *image.RGBA {
+    return r.hueRGBA(r.Rotation, Tau, gamma)
+}
+
+// LabelRGBA renders the Label of r in the LabelColor of the vector, darkened
+// by the match strength as in OrientationRGBA. count is the number of
+// vectors of the run.
+func (r *Result) LabelRGBA(count int, gamma Float) *image.RGBA {
+    return r.hueRGBA(r.Label, Float(count), gamma)
+}
+
+// LabelColor returns the color of label among count labels in LabelRGBA.
+func LabelColor(label int, count int) image.RGBAColor {
+    return hsvToRGBA(Float(label)/Float(count), 1, 1)
+}
+
+// hueRGBA renders hues divided by period as hue and the match strength as
+// value.
+func (r *Result) hueRGBA(hues *FloatGray, period Float, gamma Float) *image.RGBA {
+    rect := r.Distance.Rect
+    rgba := image.NewRGBA(rect.Dx(), rect.Dy())
+    for i, c := range r.Distance.Pix {
+        hue := hues.Pix[i].Y
+        if IsNotComputed(c.Y) || IsNotComputed(hue) {
+            rgba.Pix[i] = image.RGBAColor{0, 0, 0, 0}
+            continue
+        }
+        v := Float(math.Pow(float64(1.0 - c.Y), float64(gamma)))
+        if v > 1.0 {
+            v = 1.0
+        } else if !(v >= 0.0) {
+            v = 0.0
+        }
+        rgba.Pix[i] = hsvToRGBA(hue/period, 1, v)
+    }
+    return rgba
+}
+
+// hsvToRGBA converts a hue in [0, 1), saturation and value into an opaque
+// color.
+func hsvToRGBA(h Float, s Float, v Float) image.RGBAColor {
+    h = (h - Float(math.Floor(float64(h)))) * 6
+    sector := int(h)
+    f := h - Float(sector)
+    p := v * (1 - s)
+    q := v * (1 - s*f)
+    t := v * (1 - s*(1-f))
+
+    var r, g, b Float
+    switch sector {
+    case 0:
+        r, g, b = v, t, p
+    case 1:
+        r, g, b = q, v, p
+    case 2:
+        r, g, b = p, v, t
+    case 3:
+        r, g, b = p, q, v
+    case 4:
+        r, g, b = t, p, v
+    default:
+        r, g, b = v, p, q
+    }
+    return image.RGBAColor{uint8(r*255 + 0.5), uint8(g*255 + 0.5), uint8(b*255 + 0.5), 255}
+}
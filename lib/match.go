@@ -0,0 +1,89 @@
+package sivq
+
+// Match is the result of comparing a RingVector against another one.
+type Match struct {
+    Distance Float
+    Rotation Float // angle in radians of the rotation of B that matched best
+    Mirrored bool  // the best match was with the mirror image
+}
+
+// matcher compares RingVectors against a reference and holds everything
+// that needs to be computed only once per reference.
+type matcher struct {
+    p       SIVQParameters
+    metric  Metric
+    prepare preparer
+
+    // references, the second one being the mirror image with p.Mirror
+    references []*RingVector
+    exact      []*exactMatcher
+}
+
+func newMatcher(rv *RingVector, p SIVQParameters) *matcher {
+    p = p.normalized(rv)
+    m := &matcher{p: p, metric: p.metric()}
+    m.prepare, _ = m.metric.(preparer)
+
+    references := []*RingVector{rv}
+    if p.Mirror {
+        references = append(references, rv.mirrored())
+    }
+    for _, reference := range references {
+        if p.ExactRotation && m.metric == RMS {
+            m.exact = append(m.exact, newExactMatcher(reference, p))
+        } else if m.prepare != nil {
+            reference = reference.prepared(m.prepare)
+        }
+        m.references = append(m.references, reference)
+    }
+    return m
+}
+
+// newWorker returns a function comparing B against the references. It
+// owns buffers, so it must be used by one goroutine only. The ring data of
+// B is modified for metrics that prepare the rings.
+func (m *matcher) newWorker() func(B *RingVector) Match {
+    buffers := make([]*exactBuffer, len(m.exact))
+    for i, exact := range m.exact {
+        buffers[i] = exact.newBuffer()
+    }
+    return func(B *RingVector) Match {
+        if len(m.exact) == 0 && m.prepare != nil {
+            for _, ring := range B.Rings {
+                m.prepare.Prepare(ring.Data, ring.Stride)
+            }
+        }
+        best := Match{Distance: NotComputed()}
+        for i, reference := range m.references {
+            var d, rotation Float
+            if len(m.exact) > 0 {
+                d, rotation = m.exact[i].diff(B, buffers[i])
+            } else {
+                d, rotation = reference.diff(B, m.p, m.metric)
+            }
+            if i == 0 || d < best.Distance {
+                best = Match{d, rotation, i == 1}
+            }
+            if best.Distance <= m.p.cutoff(m.metric) {
+                break
+            }
+        }
+        return best
+    }
+}
+
+// mirrored returns a copy of rv with the samples of every ring in reverse
+// order, keeping the first sample in place. These are the rings of the
+// mirror image, reflected over the axis through the first sample.
+func (rv *RingVector) mirrored() *RingVector {
+    nrv := rv.EmptyClone()
+    for i, r := range rv.Rings {
+        data := nrv.Rings[i].Data
+        count := len(r.Data) / r.Stride
+        for j := 0; j < count; j++ {
+            k := (count - j) % count
+            copy(data[k*r.Stride:(k+1)*r.Stride], r.Data[j*r.Stride:(j+1)*r.Stride])
+        }
+    }
+    return nrv
+}
@@ -0,0 +1,285 @@
+package sivq
+
+import (
+    "math"
+    "os"
+    "sort"
+)
+
+// Metric measures how different two rings are.
+//
+// Ring compares a[i] with b[(i+base) % len(b)] for the values selected by
+// p.MatchingOffset and p.MatchingStride and returns the dissimilarity sum
+// of the ring together with its weight. Finish turns the sums and weights
+// added up over all rings into the distance, 0.0 meaning identical.
+// Cutoff is the distance that is close enough to stop searching the other
+// rotations, 0.0 to stop only at identical rings.
+type Metric interface {
+    Name() string
+    Cutoff() Float
+    Ring(a []Float, b []Float, base int, p SIVQParameters) (sum Float, weight Float)
+    Finish(sum Float, weight Float) Float
+}
+
+// preparer is implemented by metrics that need to transform the ring data
+// once before the rings are compared under different rotations.
+type preparer interface {
+    Prepare(data []Float, stride int)
+}
+
+var (
+    RMS    Metric = rmsMetric{}    // root mean squared difference
+    L1     Metric = l1Metric{}     // mean absolute difference
+    NCC    Metric = nccMetric{}    // normalized cross-correlation
+    Cosine Metric = cosineMetric{} // cosine similarity
+    Rank   Metric = rankMetric{}   // mean difference of value ranks
+)
+
+// Metrics lists all metrics known to ParseMetric.
+var Metrics = []Metric{RMS, L1, NCC, Cosine, Rank}
+
+// ParseMetric returns the metric with the given name, RMS for "".
+func ParseMetric(name string) (Metric, os.Error) {
+    if name == "" {
+        return RMS, nil
+    }
+    for _, m := range Metrics {
+        if m.Name() == name {
+            return m, nil
+        }
+    }
+    return nil, os.NewError("sivq: unknown metric " + name)
+}
+
+func (p *SIVQParameters) metric() Metric {
+    if p.Metric == nil {
+        return RMS
+    }
+    return p.Metric
+}
+
+// cutoff returns the distance at which metric stops searching the other
+// rotations, none with p.Orientation so that Rotation records the best
+// angle rather than the first one close enough.
+func (p *SIVQParameters) cutoff(metric Metric) Float {
+    if p.Orientation {
+        return Float(math.Inf(-1))
+    }
+    return metric.Cutoff()
+}
+
+// checkExact returns an error for p.ExactRotation with another metric than
+// RMS, which would silently fall back to the stepped search.
+func (p SIVQParameters) checkExact() os.Error {
+    if p.ExactRotation && p.metric() != RMS {
+        return os.NewError("sivq: exact rotation is only supported with the rms metric")
+    }
+    return nil
+}
+
+// forMatched calls f with the index pairs compared by a Metric.
+func forMatched(count int, base int, p SIVQParameters, f func(i int, i2 int)) {
+    i2 := (base + p.MatchingOffset) % count
+    for i := p.MatchingOffset; i < count; i += p.MatchingStride {
+        f(i, i2)
+        i2 += p.MatchingStride
+        if i2 >= count {
+            i2 = i2 % count
+        }
+    }
+}
+
+type rmsMetric struct{}
+
+func (rmsMetric) Name() string { return "rms" }
+
+// Cutoff is a root mean squared difference of 0.005, below what 8 bit
+// samples can resolve.
+func (rmsMetric) Cutoff() Float { return 0.005 }
+
+func (rmsMetric) Ring(a []Float, b []Float, base int, p SIVQParameters) (sum Float, weight Float) {
+    // inlined forMatched, this is the default metric
+    count := len(a)
+    i2 := (base + p.MatchingOffset) % count
+    for i := p.MatchingOffset; i < count; i += p.MatchingStride {
+        d := a[i] - b[i2]
+        sum += d * d
+        weight += 1
+        i2 += p.MatchingStride
+        if i2 >= count {
+            i2 = i2 % count
+        }
+    }
+    return
+}
+
+func (rmsMetric) Finish(sum Float, weight Float) Float {
+    return Float(math.Sqrt(float64(sum / weight)))
+}
+
+type l1Metric struct{}
+
+func (l1Metric) Name() string  { return "l1" }
+func (l1Metric) Cutoff() Float { return 0 }
+
+func (l1Metric) Ring(a []Float, b []Float, base int, p SIVQParameters) (sum Float, weight Float) {
+    count := len(a)
+    i2 := (base + p.MatchingOffset) % count
+    for i := p.MatchingOffset; i < count; i += p.MatchingStride {
+        d := a[i] - b[i2]
+        if d < 0 {
+            d = -d
+        }
+        sum += d
+        weight += 1
+        i2 += p.MatchingStride
+        if i2 >= count {
+            i2 = i2 % count
+        }
+    }
+    return
+}
+
+func (l1Metric) Finish(sum Float, weight Float) Float {
+    return sum / weight
+}
+
+// nccMetric normalizes every channel of a ring to zero mean and unit
+// variance, so that rings differing only in the brightness and contrast of
+// each channel match perfectly. The distance is (1 - correlation) / 2, the
+// correlation being averaged over the channels.
+type nccMetric struct{}
+
+func (nccMetric) Name() string  { return "ncc" }
+func (nccMetric) Cutoff() Float { return 0 }
+
+func (nccMetric) Prepare(data []Float, stride int) {
+    n := len(data) / stride
+    if n == 0 {
+        return
+    }
+    for c := 0; c < stride; c++ {
+        mean := 0.0
+        for i := c; i < len(data); i += stride {
+            mean += float64(data[i])
+        }
+        mean /= float64(n)
+
+        variance := 0.0
+        for i := c; i < len(data); i += stride {
+            d := float64(data[i]) - mean
+            variance += d * d
+        }
+        variance /= float64(n)
+
+        scale := 0.0
+        if variance > 0 {
+            scale = 1 / math.Sqrt(variance)
+        }
+        for i := c; i < len(data); i += stride {
+            data[i] = Float((float64(data[i]) - mean) * scale)
+        }
+    }
+}
+
+func (nccMetric) Ring(a []Float, b []Float, base int, p SIVQParameters) (sum Float, weight Float) {
+    forMatched(len(a), base, p, func(i int, i2 int) {
+        sum += 1 - a[i]*b[i2]
+        weight += 1
+    })
+    return
+}
+
+func (nccMetric) Finish(sum Float, weight Float) Float {
+    d := sum / weight / 2
+    if d < 0 {
+        // rounding errors of perfect matches
+        d = 0
+    }
+    return d
+}
+
+// cosineMetric compares the direction of the ring values, ignoring their
+// overall intensity. The distance of every ring is 1 - cos(angle).
+type cosineMetric struct{}
+
+func (cosineMetric) Name() string  { return "cosine" }
+func (cosineMetric) Cutoff() Float { return 0 }
+
+func (cosineMetric) Ring(a []Float, b []Float, base int, p SIVQParameters) (sum Float, weight Float) {
+    var dot, aa, bb float64
+    forMatched(len(a), base, p, func(i int, i2 int) {
+        dot += float64(a[i] * b[i2])
+        aa += float64(a[i] * a[i])
+        bb += float64(b[i2] * b[i2])
+        weight += 1
+    })
+
+    similarity := 1.0
+    if aa > 0 || bb > 0 {
+        similarity = 0.0
+        if aa > 0 && bb > 0 {
+            similarity = dot / math.Sqrt(aa*bb)
+        }
+    }
+    return Float(1-similarity) * weight, weight
+}
+
+func (cosineMetric) Finish(sum Float, weight Float) Float {
+    return sum / weight
+}
+
+// rankMetric replaces the ring values by their rank among the values of the
+// same channel of the ring, which only keeps their ordering. The distance
+// is the mean rank difference.
+type rankMetric struct{}
+
+func (rankMetric) Name() string  { return "rank" }
+func (rankMetric) Cutoff() Float { return 0 }
+
+type rankOrder struct {
+    data  []Float
+    index []int
+}
+
+func (r rankOrder) Len() int           { return len(r.index) }
+func (r rankOrder) Less(i, j int) bool { return r.data[r.index[i]] < r.data[r.index[j]] }
+func (r rankOrder) Swap(i, j int)      { r.index[i], r.index[j] = r.index[j], r.index[i] }
+
+func (rankMetric) Prepare(data []Float, stride int) {
+    n := len(data) / stride
+    if n < 2 {
+        return
+    }
+    ranks := make([]Float, len(data))
+    order := rankOrder{data, make([]int, n)}
+    scale := 1 / Float(n-1)
+    for c := 0; c < stride; c++ {
+        for i := range order.index {
+            order.index[i] = c + i*stride
+        }
+        sort.Sort(order)
+
+        for start := 0; start < n; {
+            // equal values share their average rank
+            end := start + 1
+            for end < n && data[order.index[end]] == data[order.index[start]] {
+                end += 1
+            }
+            rank := Float(start+end-1) / 2 * scale
+            for k := start; k < end; k++ {
+                ranks[order.index[k]] = rank
+            }
+            start = end
+        }
+    }
+    copy(data, ranks)
+}
+
+func (rankMetric) Ring(a []Float, b []Float, base int, p SIVQParameters) (sum Float, weight Float) {
+    return l1Metric{}.Ring(a, b, base, p)
+}
+
+func (rankMetric) Finish(sum Float, weight Float) Float {
+    return sum / weight
+}
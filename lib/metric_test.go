@@ -0,0 +1,35 @@
+package sivq
+
+import (
+    "testing"
+)
+
+// TestPrepareNormalizesChannels checks that the normalizing metrics ignore
+// a brightness and contrast change of a single channel, as a stronger or
+// weaker stain would give.
+func TestPrepareNormalizesChannels(t *testing.T) {
+    a := []Float{
+        0.1, 0.2, 0.9,
+        0.4, 0.3, 0.8,
+        0.2, 0.7, 0.5,
+        0.8, 0.5, 0.1,
+        0.6, 0.9, 0.3}
+    b := make([]Float, len(a))
+    for i := 0; i < len(a); i += 3 {
+        b[i] = a[i]
+        b[i+1] = 0.5*a[i+1] + 0.2
+        b[i+2] = 0.3 * a[i+2]
+    }
+
+    p := SIVQParameters{MatchingStride: 1}
+    for _, m := range []Metric{NCC, Rank} {
+        pa := append([]Float{}, a...)
+        pb := append([]Float{}, b...)
+        m.(preparer).Prepare(pa, 3)
+        m.(preparer).Prepare(pb, 3)
+        sum, weight := m.Ring(pa, pb, 0, p)
+        if d := m.Finish(sum, weight); d > 1e-5 {
+            t.Errorf("%s distance %g, want 0", m.Name(), d)
+        }
+    }
+}
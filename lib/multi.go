@@ -0,0 +1,162 @@
+package sivq
+
+import (
+    "image"
+    "os"
+)
+
+// MultiImage is an image with an arbitrary number of channels per pixel,
+// such as multispectral or fluorescence data. The channel values of a pixel
+// are stored next to each other.
+type MultiImage struct {
+    Pix      []Float
+    Channels int
+    Stride   int // pixels per row
+    Rect     image.Rectangle
+}
+
+// NewMultiImage returns a MultiImage with the given size and channel count.
+func NewMultiImage(w, h, channels int) *MultiImage {
+    pix := make([]Float, w*h*channels)
+    return &MultiImage{pix, channels, w, image.Rect(0, 0, w, h)}
+}
+
+// NewMultiImageFromRGBA converts m into the channels of color space cs.
+func NewMultiImageFromRGBA(m *image.RGBA, cs ColorSpace) *MultiImage {
+    w, h := m.Rect.Dx(), m.Rect.Dy()
+    multi := NewMultiImage(w, h, cs.Channels())
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            cs.Convert(m.Pix[y*m.Stride+x], multi.Pixel(x, y))
+        }
+    }
+    return multi
+}
+
+// NewMultiImageFromChannels combines single channel images of the same size
+// into one MultiImage, the gray level of channels[i] becoming channel i.
+func NewMultiImageFromChannels(channels []image.Image) (*MultiImage, os.Error) {
+    if len(channels) == 0 {
+        return nil, os.NewError("sivq: no channels")
+    }
+    b := channels[0].Bounds()
+    multi := NewMultiImage(b.Dx(), b.Dy(), len(channels))
+    for c, m := range channels {
+        mb := m.Bounds()
+        if mb.Dx() != b.Dx() || mb.Dy() != b.Dy() {
+            return nil, os.NewError("sivq: channel images have different sizes")
+        }
+        for y := 0; y < mb.Dy(); y++ {
+            for x := 0; x < mb.Dx(); x++ {
+                gray := toFloatGrayColor(m.At(mb.Min.X+x, mb.Min.Y+y)).(FloatGrayColor)
+                multi.Pix[(y*multi.Stride+x)*multi.Channels+c] = gray.Y
+            }
+        }
+    }
+    return multi, nil
+}
+
+// Pixel returns the channel values of the pixel at (x, y).
+func (m *MultiImage) Pixel(x, y int) []Float {
+    i := (y*m.Stride + x) * m.Channels
+    return m.Pix[i : i+m.Channels]
+}
+
+// LoadMulti samples all rings around (X, Y) from a MultiImage. Pixels
+// outside of the image are clamped to its edges.
+func (rv *RingVector) LoadMulti(input *MultiImage, X int, Y int) {
+    c := rv.sampler()
+    sum := rv.sumBuffer(input.Channels)
+    for i := range rv.Rings {
+        rv.Rings[i].loadBorderMulti(input, rv.Weights, c, X, Y, BorderClamp, 0, sum)
+    }
+}
+
+// sumBuffer returns the scratch space of rv for summing the taps of
+// interpolated samples of channels values.
+func (rv *RingVector) sumBuffer(channels int) []Float {
+    if len(rv.sum) != channels {
+        rv.sum = make([]Float, channels)
+    }
+    return rv.sum
+}
+
+func setWeighted(data []Float, values []Float, weights []Float) {
+    copy(data, values)
+    for i, w := range weights {
+        if i < len(values) {
+            data[i] *= w
+        }
+    }
+}
+
+// addWeighted adds values multiplied with w to sum.
+func addWeighted(sum []Float, values []Float, w Float) {
+    for i, v := range values {
+        sum[i] += w * v
+    }
+}
+
+func (r *RingVectorRing) loadTableMulti(input *MultiImage, weights []Float, center int, t *RingTable, sum []Float) {
+    offsets := t.Offsets[r.Radius]
+    channels := input.Channels
+    if t.Taps == 1 && channels == 1 && len(weights) == 0 {
+        // single channel fast path
+        for i, offset := range offsets {
+            r.Data[i] = input.Pix[center+offset]
+        }
+        return
+    }
+    if t.Taps == 1 {
+        i2 := 0
+        for _, offset := range offsets {
+            i := (center + offset) * channels
+            setWeighted(r.Data[i2:i2+channels], input.Pix[i:i+channels], weights)
+            i2 += r.Stride
+        }
+        return
+    }
+    tapWeights := t.Weights[r.Radius]
+    i2 := 0
+    for i := 0; i < len(offsets); i += t.Taps {
+        for ch := range sum {
+            sum[ch] = 0
+        }
+        for j := i; j < i+t.Taps; j++ {
+            k := (center + offsets[j]) * channels
+            addWeighted(sum, input.Pix[k:k+channels], tapWeights[j])
+        }
+        setWeighted(r.Data[i2:i2+channels], sum, weights)
+        i2 += r.Stride
+    }
+}
+
+func (r *RingVectorRing) loadBorderMulti(input *MultiImage, weights []Float, c Circle, X int, Y int, mode BorderMode, value Float, sum []Float) {
+    w, h := input.Rect.Dx(), input.Rect.Dy()
+    channels := input.Channels
+    taps, n := c.GetTaps(r.Radius)
+    i2 := 0
+    for i := 0; i < len(taps); i += n {
+        for ch := range sum {
+            sum[ch] = 0
+        }
+        ok := true
+        for _, t := range taps[i : i+n] {
+            x, okX := borderCoord(X+t.X, w, mode)
+            y, okY := borderCoord(Y+t.Y, h, mode)
+            if !okX || !okY {
+                ok = false
+                break
+            }
+            addWeighted(sum, input.Pixel(x, y), t.Weight)
+        }
+        if ok {
+            setWeighted(r.Data[i2:i2+channels], sum, weights)
+        } else {
+            for ch := 0; ch < channels; ch++ {
+                r.Data[i2+ch] = value
+            }
+        }
+        i2 += r.Stride
+    }
+}
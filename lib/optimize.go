@@ -0,0 +1,228 @@
+package sivq
+
+import (
+    "image"
+    "os"
+)
+
+// OptimizeTolerance is how much lower than the best score Optimize
+// accepts for faster strides.
+const OptimizeTolerance = 0.01
+
+// SearchSpace lists the values Optimize tries for every parameter. An
+// empty list keeps the value of the parameters Optimize is given.
+type SearchSpace struct {
+    Radius         []int
+    Count          []int
+    RadiusInc      []int
+    Metrics        []Metric
+    MatchingStride []int
+    RotationStride []Float
+}
+
+// DefaultSearchSpace has the values offered when adjusting parameters by
+// hand in the web interface.
+var DefaultSearchSpace = SearchSpace{
+    Radius:         []int{3, 4, 7, 10},
+    Count:          []int{1, 2, 3},
+    RadiusInc:      []int{1, 2, 3, 5},
+    Metrics:        Metrics,
+    MatchingStride: []int{1, 2, 3, 5},
+    RotationStride: []Float{0.001, Tau / 32, Tau / 16, Tau / 8}}
+
+// Candidate is a parameter set with its separation of the annotations.
+type Candidate struct {
+    Vector RingVectorParameters
+    Params SIVQParameters
+    Score  Float // probability that a positive point matches better than a negative one
+    Margin Float // mean distance of the negative points minus the positive ones
+}
+
+// better reports whether c separates the annotations better than d.
+func (c *Candidate) better(d *Candidate) bool {
+    return c.Score > d.Score || c.Score == d.Score && c.Margin > d.Margin
+}
+
+// Optimize searches space for the parameters of a vector sampled at center
+// that separate the positive from the negative points of input best. The
+// ring parameters and the metric are searched first with the smallest
+// strides, then the fastest strides scoring at most OptimizeTolerance less
+// are chosen. The rest of the parameters are taken from rvp and p.
+func Optimize(ctx Context, input *image.RGBA, rvp RingVectorParameters, p SIVQParameters, center image.Point, positives []image.Point, negatives []image.Point, space SearchSpace) (*Candidate, os.Error) {
+    if len(positives) == 0 || len(negatives) == 0 {
+        return nil, os.NewError("sivq: optimizing needs positive and negative points")
+    }
+    if _, err := ParseSampler(rvp.Sampler, rvp.Samples); err != nil {
+        return nil, err
+    }
+    if p.ProgressCallback == nil {
+        p.ProgressCallback = func(pr Progress) {}
+    }
+    space = space.filled(rvp, p)
+    if p.ExactRotation {
+        // the other metrics have no exact search
+        space.Metrics = []Metric{RMS}
+    }
+
+    // ring parameters and metric, skipping increments of single rings
+    p.MatchingStride = minInt(space.MatchingStride)
+    p.RotationStride = minFloat(space.RotationStride)
+    var rings []*Candidate
+    for _, radius := range space.Radius {
+        for _, count := range space.Count {
+            for i, inc := range space.RadiusInc {
+                if count == 1 && i > 0 {
+                    break
+                }
+                for _, metric := range space.Metrics {
+                    c := &Candidate{Vector: rvp, Params: p}
+                    c.Vector.Radius, c.Vector.Count, c.Vector.RadiusInc = radius, count, inc
+                    c.Params.Metric = metric
+                    rings = append(rings, c)
+                }
+            }
+        }
+    }
+    strides := len(space.MatchingStride) * len(space.RotationStride)
+    tracker := newProgressTracker(p.ProgressCallback, len(rings)+strides)
+
+    scoreCandidates(ctx, tracker, input, center, positives, negatives, rings)
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    best := rings[0]
+    for _, c := range rings[1:] {
+        if c.better(best) {
+            best = c
+        }
+    }
+
+    // the fastest strides that separate almost as well
+    var faster []*Candidate
+    for _, ms := range space.MatchingStride {
+        for _, rs := range space.RotationStride {
+            c := &Candidate{Vector: best.Vector, Params: best.Params}
+            c.Params.MatchingStride, c.Params.RotationStride = ms, rs
+            faster = append(faster, c)
+        }
+    }
+    scoreCandidates(ctx, tracker, input, center, positives, negatives, faster)
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    chosen := best
+    for _, c := range faster {
+        if c.Score < best.Score-OptimizeTolerance {
+            continue
+        }
+        speed, chosenSpeed := c.speed(), chosen.speed()
+        if speed > chosenSpeed || speed == chosenSpeed && c.better(chosen) {
+            chosen = c
+        }
+    }
+    return chosen, nil
+}
+
+// filled returns the space with the values of rvp and p for every empty
+// list.
+func (space SearchSpace) filled(rvp RingVectorParameters, p SIVQParameters) SearchSpace {
+    if len(space.Radius) == 0 {
+        space.Radius = []int{rvp.Radius}
+    }
+    if len(space.Count) == 0 {
+        space.Count = []int{rvp.Count}
+    }
+    if len(space.RadiusInc) == 0 {
+        space.RadiusInc = []int{rvp.RadiusInc}
+    }
+    if len(space.Metrics) == 0 {
+        space.Metrics = []Metric{p.metric()}
+    }
+    if len(space.MatchingStride) == 0 {
+        space.MatchingStride = []int{p.MatchingStride}
+    }
+    if len(space.RotationStride) == 0 {
+        space.RotationStride = []Float{p.RotationStride}
+    }
+    return space
+}
+
+// speed is proportional to how fast the strides of c are.
+func (c *Candidate) speed() Float {
+    rv := NewRingVector(c.Vector)
+    p := c.Params.normalized(rv)
+    if p.ExactRotation {
+        return Float(p.MatchingStride)
+    }
+    return Float(p.MatchingStride) * p.RotationStride
+}
+
+// scoreCandidates sets the score and margin of every candidate, spread over
+// p.Workers goroutines of the first candidate.
+func scoreCandidates(ctx Context, tracker *progressTracker, input *image.RGBA, center image.Point, positives []image.Point, negatives []image.Point, candidates []*Candidate) {
+    p := candidates[0].Params
+    p.ChunkRows = 1
+    forEachRow(ctx, tracker, p, 0, len(candidates), func() func(i int) {
+        return func(i int) {
+            c := candidates[i]
+            rv := NewRingVector(c.Vector)
+            rv.LoadData(input, center.X, center.Y)
+            match := newMatcher(rv, c.Params).newWorker()
+            distances := func(points []image.Point) []Float {
+                d := make([]Float, len(points))
+                for j, pt := range points {
+                    B := NewRingVector(c.Vector)
+                    B.LoadData(input, pt.X, pt.Y)
+                    d[j] = match(B).Distance
+                }
+                return d
+            }
+            c.Score, c.Margin = separation(distances(positives), distances(negatives))
+        }
+    })
+}
+
+// separation returns the probability that a positive distance is smaller
+// than a negative one, counting ties as half, and the difference of their
+// means.
+func separation(positives []Float, negatives []Float) (score Float, margin Float) {
+    for _, dp := range positives {
+        for _, dn := range negatives {
+            if dp < dn {
+                score += 1
+            } else if dp == dn {
+                score += 0.5
+            }
+        }
+    }
+    score /= Float(len(positives) * len(negatives))
+    return score, mean(negatives) - mean(positives)
+}
+
+func mean(values []Float) Float {
+    sum := Float(0)
+    for _, v := range values {
+        sum += v
+    }
+    return sum / Float(len(values))
+}
+
+func minInt(values []int) int {
+    m := values[0]
+    for _, v := range values[1:] {
+        if v < m {
+            m = v
+        }
+    }
+    return m
+}
+
+func minFloat(values []Float) Float {
+    m := values[0]
+    for _, v := range values[1:] {
+        if v < m {
+            m = v
+        }
+    }
+    return m
+}
@@ -0,0 +1,45 @@
+package sivq
+
+import (
+    "time"
+)
+
+// Progress describes how far a SIVQ run has got. Rows only ever increases
+// and reaches Total when the run finishes.
+type Progress struct {
+    Rows      int   // rows completed over all passes
+    Total     int   // rows to be processed over all passes
+    Elapsed   int64 // nanoseconds since the run started
+    Remaining int64 // estimated nanoseconds until the run finishes
+}
+
+// Fraction returns the completed part of the run between 0.0 and 1.0.
+func (pr Progress) Fraction() Float {
+    if pr.Total <= 0 {
+        return 1.0
+    }
+    return Float(pr.Rows) / Float(pr.Total)
+}
+
+// progressTracker counts finished rows and reports them to the callback.
+// It must only be used from a single goroutine.
+type progressTracker struct {
+    callback func(Progress)
+    start    int64
+    rows     int
+    total    int
+}
+
+func newProgressTracker(callback func(Progress), total int) *progressTracker {
+    return &progressTracker{callback: callback, start: time.Nanoseconds(), total: total}
+}
+
+func (t *progressTracker) rowDone() {
+    t.rows += 1
+    pr := Progress{Rows: t.rows, Total: t.total}
+    pr.Elapsed = time.Nanoseconds() - t.start
+    if t.rows < t.total {
+        pr.Remaining = pr.Elapsed * int64(t.total-t.rows) / int64(t.rows)
+    }
+    t.callback(pr)
+}
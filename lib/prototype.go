@@ -0,0 +1,129 @@
+package sivq
+
+import (
+    "image"
+    "os"
+)
+
+// prototypeIterations is how many times the samples are aligned to the
+// prototype learned so far. The first alignment is to the first sample.
+const prototypeIterations = 3
+
+// Example is a location in an image to learn a prototype from.
+type Example struct {
+    Image *image.RGBA
+    X     int
+    Y     int
+}
+
+// SampleExamples returns a RingVector with the parameters rvp sampled at
+// every example.
+func SampleExamples(rvp RingVectorParameters, examples []Example) []*RingVector {
+    samples := make([]*RingVector, len(examples))
+    for i, e := range examples {
+        samples[i] = NewRingVector(rvp)
+        samples[i].LoadData(e.Image, e.X, e.Y)
+    }
+    return samples
+}
+
+// LearnPrototype averages samples of the same structure, taken for example
+// with SampleExamples or LoadMulti at several locations. Every sample is
+// rotated, and with p.Mirror possibly mirrored, to its best match with the
+// prototype before averaging. The variance of the aligned samples is
+// stored in the Variance of the prototype rings.
+func LearnPrototype(p SIVQParameters, samples []*RingVector) (*RingVector, os.Error) {
+    if len(samples) == 0 {
+        return nil, os.NewError("sivq: no samples to learn from")
+    }
+    if err := p.checkExact(); err != nil {
+        return nil, err
+    }
+    for _, s := range samples[1:] {
+        if !samples[0].sameRings(s) {
+            return nil, os.NewError("sivq: samples have different rings")
+        }
+    }
+
+    prototype := samples[0].Clone()
+    aligned := make([]*RingVector, len(samples))
+    for iteration := 0; iteration < prototypeIterations; iteration++ {
+        m := newMatcher(prototype, p)
+        match := m.newWorker()
+        for i, s := range samples {
+            B := s
+            if m.prepare != nil {
+                B = s.Clone()
+            }
+            aligned[i] = s.aligned(match(B))
+        }
+        prototype = average(aligned)
+    }
+    prototype.Examples = len(samples)
+    return prototype, nil
+}
+
+// sameRings reports whether the rings of rv and B have the same radii and
+// sizes.
+func (rv *RingVector) sameRings(B *RingVector) bool {
+    if len(rv.Rings) != len(B.Rings) {
+        return false
+    }
+    for i, r := range rv.Rings {
+        if r.Radius != B.Rings[i].Radius || len(r.Data) != len(B.Rings[i].Data) ||
+            r.Stride != B.Rings[i].Stride {
+            return false
+        }
+    }
+    return true
+}
+
+// aligned returns a copy of rv rotated, and mirrored, by the match of rv
+// against a reference, so that its samples line up with the reference.
+func (rv *RingVector) aligned(m Match) *RingVector {
+    nrv := rv.EmptyClone()
+    for ri, r := range rv.Rings {
+        data := nrv.Rings[ri].Data
+        stride := r.Stride
+        count := len(r.Data) / stride
+        shift := rotationBase(m.Rotation, len(r.Data), stride) / stride
+        for k := 0; k < count; k++ {
+            // the reference sample k was compared against sample j
+            j := (k + shift) % count
+            if m.Mirrored {
+                j = ((shift-k)%count + count) % count
+            }
+            copy(data[k*stride:(k+1)*stride], r.Data[j*stride:(j+1)*stride])
+        }
+    }
+    return nrv
+}
+
+// average returns the mean of vectors with the same rings and the
+// variance of every value.
+func average(vectors []*RingVector) *RingVector {
+    mean := vectors[0].EmptyClone()
+    n := Float(len(vectors))
+    for ri := range mean.Rings {
+        r := &mean.Rings[ri]
+        r.Variance = make([]Float, len(r.Data))
+        for _, v := range vectors {
+            for i, x := range v.Rings[ri].Data {
+                r.Data[i] += x
+            }
+        }
+        for i := range r.Data {
+            r.Data[i] /= n
+        }
+        for _, v := range vectors {
+            for i, x := range v.Rings[ri].Data {
+                d := x - r.Data[i]
+                r.Variance[i] += d * d
+            }
+        }
+        for i := range r.Variance {
+            r.Variance[i] /= n
+        }
+    }
+    return mean
+}
@@ -0,0 +1,221 @@
+package sivq
+
+import (
+    "fmt"
+    "image"
+    "io"
+    "os"
+)
+
+// Masks are FloatGray images where 1 is inside and 0 outside.
+
+// Region is a connected component of a mask.
+type Region struct {
+    Label        int // value of the region in the label map, from 1
+    Area         int // pixels
+    CentroidX    Float
+    CentroidY    Float
+    Bounds       image.Rectangle
+    MeanDistance Float // of the distance map over the region
+    MinDistance  Float
+}
+
+// MatchMask returns the mask of the computed pixels with a distance up to
+// threshold.
+func (p *FloatGray) MatchMask(threshold Float) *FloatGray {
+    mask := NewFloatGray(p.Rect.Dx(), p.Rect.Dy())
+    for i, c := range p.Pix {
+        if !IsNotComputed(c.Y) && c.Y <= threshold {
+            mask.Pix[i].Y = 1
+        }
+    }
+    return mask
+}
+
+// Dilated returns the mask grown by a disk of radius.
+func (p *FloatGray) Dilated(radius int) *FloatGray {
+    return p.morphology(radius, 1)
+}
+
+// Eroded returns the mask shrunk by a disk of radius. Pixels outside the
+// image don't shrink it.
+func (p *FloatGray) Eroded(radius int) *FloatGray {
+    return p.morphology(radius, 0)
+}
+
+// Opened returns the mask eroded and dilated, which removes parts thinner
+// than the disk of radius.
+func (p *FloatGray) Opened(radius int) *FloatGray {
+    return p.Eroded(radius).Dilated(radius)
+}
+
+// Closed returns the mask dilated and eroded, which fills gaps thinner
+// than the disk of radius.
+func (p *FloatGray) Closed(radius int) *FloatGray {
+    return p.Dilated(radius).Eroded(radius)
+}
+
+// morphology sets every pixel of the mask within radius of a pixel equal to
+// value to value.
+func (p *FloatGray) morphology(radius int, value Float) *FloatGray {
+    w, h := p.Rect.Dx(), p.Rect.Dy()
+    out := NewFloatGray(w, h)
+    copy(out.Pix, p.Pix)
+    if radius <= 0 {
+        return out
+    }
+
+    var disk []image.Point
+    for dy := -radius; dy <= radius; dy++ {
+        for dx := -radius; dx <= radius; dx++ {
+            if dx*dx+dy*dy <= radius*radius {
+                disk = append(disk, image.Point{dx, dy})
+            }
+        }
+    }
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            if p.Pix[y*p.Stride+x].Y != value {
+                continue
+            }
+            for _, d := range disk {
+                nx, ny := x+d.X, y+d.Y
+                if nx >= 0 && ny >= 0 && nx < w && ny < h {
+                    out.Pix[ny*out.Stride+nx].Y = value
+                }
+            }
+        }
+    }
+    return out
+}
+
+// HolesFilled returns the mask with every outside area that doesn't touch
+// the image border set inside.
+func (p *FloatGray) HolesFilled() *FloatGray {
+    w, h := p.Rect.Dx(), p.Rect.Dy()
+    out := NewFloatGray(w, h)
+    for i := range out.Pix {
+        out.Pix[i].Y = 1
+    }
+
+    // flood the outside from the border
+    var stack []image.Point
+    push := func(x int, y int) {
+        if x >= 0 && y >= 0 && x < w && y < h && p.Pix[y*p.Stride+x].Y == 0 && out.Pix[y*out.Stride+x].Y == 1 {
+            out.Pix[y*out.Stride+x].Y = 0
+            stack = append(stack, image.Point{x, y})
+        }
+    }
+    for x := 0; x < w; x++ {
+        push(x, 0)
+        push(x, h-1)
+    }
+    for y := 0; y < h; y++ {
+        push(0, y)
+        push(w-1, y)
+    }
+    for len(stack) > 0 {
+        pt := stack[len(stack)-1]
+        stack = stack[:len(stack)-1]
+        push(pt.X-1, pt.Y)
+        push(pt.X+1, pt.Y)
+        push(pt.X, pt.Y-1)
+        push(pt.X, pt.Y+1)
+    }
+    return out
+}
+
+// Regions labels the 8-connected components of the mask with at least
+// minArea pixels and measures them on distances, which may be nil. The
+// label map has the label of the region of every pixel and 0 outside.
+func (p *FloatGray) Regions(distances *FloatGray, minArea int) (*FloatGray, []Region) {
+    w, h := p.Rect.Dx(), p.Rect.Dy()
+    labels := NewFloatGray(w, h)
+    visited := make([]bool, w*h)
+    var regions []Region
+
+    var pixels []image.Point
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            if visited[y*w+x] || p.Pix[y*p.Stride+x].Y == 0 {
+                continue
+            }
+
+            // collect the component
+            pixels = append(pixels[:0], image.Point{x, y})
+            visited[y*w+x] = true
+            for i := 0; i < len(pixels); i++ {
+                pt := pixels[i]
+                for ny := pt.Y - 1; ny <= pt.Y+1; ny++ {
+                    for nx := pt.X - 1; nx <= pt.X+1; nx++ {
+                        if nx >= 0 && ny >= 0 && nx < w && ny < h && !visited[ny*w+nx] && p.Pix[ny*p.Stride+nx].Y != 0 {
+                            visited[ny*w+nx] = true
+                            pixels = append(pixels, image.Point{nx, ny})
+                        }
+                    }
+                }
+            }
+            if len(pixels) < minArea {
+                continue
+            }
+
+            r := Region{Label: len(regions) + 1, Area: len(pixels), MinDistance: NotComputed()}
+            r.Bounds = image.Rectangle{pixels[0], pixels[0].Add(image.Point{1, 1})}
+            sum, computed := Float(0), 0
+            for _, pt := range pixels {
+                labels.Pix[pt.Y*labels.Stride+pt.X].Y = Float(r.Label)
+                r.CentroidX += Float(pt.X)
+                r.CentroidY += Float(pt.Y)
+                r.Bounds = r.Bounds.Union(image.Rectangle{pt, pt.Add(image.Point{1, 1})})
+                if distances == nil {
+                    continue
+                }
+                if d := distances.Pix[pt.Y*distances.Stride+pt.X].Y; !IsNotComputed(d) {
+                    sum += d
+                    computed++
+                    if computed == 1 || d < r.MinDistance {
+                        r.MinDistance = d
+                    }
+                }
+            }
+            r.CentroidX /= Float(r.Area)
+            r.CentroidY /= Float(r.Area)
+            r.MeanDistance = NotComputed()
+            if computed > 0 {
+                r.MeanDistance = sum / Float(computed)
+            }
+            regions = append(regions, r)
+        }
+    }
+    return labels, regions
+}
+
+// RegionsRGBA renders a label map of count regions with a color per label
+// and black outside.
+func RegionsRGBA(labels *FloatGray, count int) *image.RGBA {
+    rgba := image.NewRGBA(labels.Rect.Dx(), labels.Rect.Dy())
+    for i, c := range labels.Pix {
+        if c.Y < 1 {
+            rgba.Pix[i] = image.RGBAColor{0, 0, 0, 255}
+            continue
+        }
+        rgba.Pix[i] = LabelColor(int(c.Y)-1, count)
+    }
+    return rgba
+}
+
+// WriteRegionsCSV writes one region per line.
+func WriteRegionsCSV(w io.Writer, regions []Region) os.Error {
+    _, err := fmt.Fprintln(w, "label,area,centroid_x,centroid_y,min_x,min_y,max_x,max_y,mean_distance,min_distance")
+    if err != nil {
+        return err
+    }
+    for _, r := range regions {
+        _, err = fmt.Fprintf(w, "%d,%d,%g,%g,%d,%d,%d,%d,%g,%g\n", r.Label, r.Area, r.CentroidX, r.CentroidY,
+            r.Bounds.Min.X, r.Bounds.Min.Y, r.Bounds.Max.X, r.Bounds.Max.Y, r.MeanDistance, r.MinDistance)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,179 @@
+package sivq
+
+import (
+    "image"
+    "testing"
+)
+
+// maskImage returns a mask with rows drawn as '#' inside and '.' outside.
+func maskImage(rows ...string) *FloatGray {
+    m := NewFloatGray(len(rows[0]), len(rows))
+    for y, row := range rows {
+        for x, c := range row {
+            if c == '#' {
+                m.Pix[y*m.Stride+x].Y = 1
+            }
+        }
+    }
+    return m
+}
+
+// maskRows draws m as maskImage reads it.
+func maskRows(m *FloatGray) []string {
+    rows := make([]string, m.Rect.Dy())
+    for y := range rows {
+        row := make([]byte, m.Rect.Dx())
+        for x := range row {
+            row[x] = '.'
+            if m.Pix[y*m.Stride+x].Y != 0 {
+                row[x] = '#'
+            }
+        }
+        rows[y] = string(row)
+    }
+    return rows
+}
+
+func equalRows(a []string, b []string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func TestRegions(t *testing.T) {
+    tests := []struct {
+        name    string
+        mask    []string
+        minArea int
+        areas   []int
+        labels  []string // label of every pixel, '.' for none
+    }{
+        {"diagonal", []string{
+            "#...",
+            ".#..",
+            "..#."}, 1, []int{3}, []string{
+            "1...",
+            ".1..",
+            "..1."}},
+        {"apart", []string{
+            "##.#",
+            "...#",
+            "#..."}, 1, []int{2, 2, 1}, []string{
+            "11.2",
+            "...2",
+            "3..."}},
+        {"small dropped", []string{
+            "##.#",
+            "##..",
+            "...."}, 2, []int{4}, []string{
+            "11..",
+            "11..",
+            "...."}},
+        {"u shape", []string{
+            "#.#",
+            "#.#",
+            "###"}, 1, []int{7}, []string{
+            "1.1",
+            "1.1",
+            "111"}},
+    }
+    for _, test := range tests {
+        labels, regions := maskImage(test.mask...).Regions(nil, test.minArea)
+        ok := len(regions) == len(test.areas)
+        for i := 0; ok && i < len(regions); i++ {
+            ok = regions[i].Label == i+1 && regions[i].Area == test.areas[i]
+        }
+        if !ok {
+            t.Errorf("%s: regions %v, want areas %v", test.name, regions, test.areas)
+            continue
+        }
+        for y, row := range test.labels {
+            for x, c := range row {
+                want := Float(0)
+                if c != '.' {
+                    want = Float(c - '0')
+                }
+                if got := labels.Pix[y*labels.Stride+x].Y; got != want {
+                    t.Errorf("%s: label %g at %d,%d, want %g", test.name, got, x, y, want)
+                }
+            }
+        }
+    }
+}
+
+func TestRegionMeasures(t *testing.T) {
+    mask := maskImage(
+        "....",
+        ".##.",
+        ".#..")
+    distances := grayImage(
+        []Float{1, 1, 1, 1},
+        []Float{1, 0.2, 0.4, 1},
+        []Float{1, NotComputed(), 1, 1})
+    _, regions := mask.Regions(distances, 1)
+    if len(regions) != 1 {
+        t.Fatalf("%d regions, want 1", len(regions))
+    }
+    r := regions[0]
+    if !r.Bounds.Eq(image.Rect(1, 1, 3, 3)) {
+        t.Errorf("bounds %v, want (1,1)-(3,3)", r.Bounds)
+    }
+    if !near(r.CentroidX, 4.0/3) || !near(r.CentroidY, 4.0/3) {
+        t.Errorf("centroid %g,%g, want 4/3,4/3", r.CentroidX, r.CentroidY)
+    }
+    if !near(r.MeanDistance, 0.3) || !near(r.MinDistance, 0.2) {
+        t.Errorf("mean distance %g, min %g, want 0.3 and 0.2", r.MeanDistance, r.MinDistance)
+    }
+}
+
+func TestMorphology(t *testing.T) {
+    tests := []struct {
+        name string
+        got  *FloatGray
+        want []string
+    }{
+        {"dilated", maskImage(
+            ".....",
+            ".....",
+            "..#..",
+            ".....").Dilated(1), []string{
+            ".....",
+            "..#..",
+            ".###.",
+            "..#.."}},
+        {"opened", maskImage(
+            "###..",
+            "###.#",
+            "###..").Opened(1), []string{
+            "###..",
+            "###..",
+            "###.."}},
+        {"closed", maskImage(
+            "##.##",
+            "##.##",
+            "##.##").Closed(1), []string{
+            "#####",
+            "#####",
+            "#####"}},
+        {"holes filled", maskImage(
+            "#####.",
+            "#..#..",
+            "#####.",
+            "......").HolesFilled(), []string{
+            "#####.",
+            "####..",
+            "#####.",
+            "......"}},
+    }
+    for _, test := range tests {
+        if got := maskRows(test.got); !equalRows(got, test.want) {
+            t.Errorf("%s: %v, want %v", test.name, got, test.want)
+        }
+    }
+}
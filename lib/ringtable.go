@@ -0,0 +1,133 @@
+package sivq
+
+import (
+    "image"
+)
+
+// RingTable holds, for every ring radius of a RingVector, the offsets of the
+// pixels the ring samples are taken from, relative to the ring center in an
+// image with the given stride. Every sample has Taps consecutive offsets
+// and, with more than one tap, the matching interpolation weights. A
+// RingTable is never modified after it has been built, so it can be shared
+// by any number of goroutines.
+type RingTable struct {
+    Stride  int
+    Taps    int
+    Offsets map[int][]int
+    Weights map[int][]Float
+}
+
+// NewRingTable precomputes the ring offsets of circle c for the given radii.
+func NewRingTable(c Circle, radii []int, stride int) *RingTable {
+    t := &RingTable{Stride: stride, Taps: 1, Offsets: make(map[int][]int),
+        Weights: make(map[int][]Float)}
+    for _, radius := range radii {
+        if _, ok := t.Offsets[radius]; ok {
+            continue
+        }
+        taps, n := c.GetTaps(radius)
+        t.Taps = n
+        offsets := make([]int, len(taps))
+        for i, tap := range taps {
+            offsets[i] = tap.Y*stride + tap.X
+        }
+        t.Offsets[radius] = offsets
+        if n > 1 {
+            weights := make([]Float, len(taps))
+            for i, tap := range taps {
+                weights[i] = tap.Weight
+            }
+            t.Weights[radius] = weights
+        }
+    }
+    return t
+}
+
+// Table returns the RingTable of rv for images with the given stride. The
+// table is built on first use and reused afterwards.
+func (rv *RingVector) Table(stride int) *RingTable {
+    rv.tableLock.Lock()
+    defer rv.tableLock.Unlock()
+
+    if t, ok := rv.tables[stride]; ok {
+        return t
+    }
+    if rv.tables == nil {
+        rv.tables = make(map[int]*RingTable)
+    }
+
+    radii := make([]int, len(rv.Rings))
+    for i, r := range rv.Rings {
+        radii[i] = r.Radius
+    }
+    t := NewRingTable(rv.sampler(), radii, stride)
+    rv.tables[stride] = t
+    return t
+}
+
+func (r *RingVectorRing) loadTable(pix []image.RGBAColor, conv *colorConverter, center int, t *RingTable) {
+    offsets := t.Offsets[r.Radius]
+    i2 := 0
+    if t.Taps == 1 {
+        for _, offset := range offsets {
+            conv.set(r.Data[i2:], pix[center+offset])
+            i2 += r.Stride
+        }
+        return
+    }
+    weights := t.Weights[r.Radius]
+    for i := 0; i < len(offsets); i += t.Taps {
+        var cr, cg, cb Float
+        for j := i; j < i+t.Taps; j++ {
+            c := pix[center+offsets[j]]
+            w := weights[j]
+            cr += w * Float(c.R)
+            cg += w * Float(c.G)
+            cb += w * Float(c.B)
+        }
+        conv.setFloat(r.Data[i2:], clamp255(cr), clamp255(cg), clamp255(cb))
+        i2 += r.Stride
+    }
+}
+
+func (r *RingVectorRing) loadTableGray(pix []FloatGrayColor, center int, t *RingTable) {
+    offsets := t.Offsets[r.Radius]
+    if t.Taps == 1 && r.Stride == 1 {
+        for i, offset := range offsets {
+            r.Data[i] = pix[center+offset].Y
+        }
+        return
+    }
+    weights := t.Weights[r.Radius]
+    i2 := 0
+    for i := 0; i < len(offsets); i += t.Taps {
+        var y Float
+        if t.Taps == 1 {
+            y = pix[center+offsets[i]].Y
+        } else {
+            for j := i; j < i+t.Taps; j++ {
+                y += weights[j] * pix[center+offsets[j]].Y
+            }
+        }
+        for c := 0; c < r.Stride; c++ {
+            r.Data[i2+c] = y
+        }
+        i2 += r.Stride
+    }
+}
+
+// loadTable is LoadData using precomputed offsets from t.
+func (rv *RingVector) loadTable(input *image.RGBA, t *RingTable, conv *colorConverter, X int, Y int) {
+    center := Y*input.Stride + X
+    for i := range rv.Rings {
+        rv.Rings[i].loadTable(input.Pix, conv, center, t)
+    }
+}
+
+// loadTableGray is LoadDataGray using precomputed offsets from t.
+func (rv *RingVector) loadTableGray(input *FloatGray, t *RingTable, X int, Y int) {
+    center := Y*input.Stride + X
+    for i := range rv.Rings {
+        rv.Rings[i].loadTableGray(input.Pix, center, t)
+    }
+}
@@ -0,0 +1,124 @@
+package sivq
+
+import (
+    "image"
+    "os"
+    "strconv"
+    "strings"
+)
+
+// TissueBrightness is the lowest brightness of the darkest channel that
+// TissueMask ever treats as glass. Darker pixels are always tissue, brighter
+// ones only glass when they are above Otsu's threshold too.
+const TissueBrightness = 0.8
+
+// ParseRects parses comma separated rectangles given by their corners such
+// as "0:0:100:50,200:10:300:90".
+func ParseRects(s string) ([]image.Rectangle, os.Error) {
+    fields := strings.Fields(strings.Replace(s, ",", " ", -1))
+    rects := make([]image.Rectangle, len(fields))
+    for i, field := range fields {
+        corners := strings.Fields(strings.Replace(field, ":", " ", -1))
+        if len(corners) != 4 {
+            return nil, os.NewError("sivq: invalid rectangle " + field)
+        }
+        var v [4]int
+        for j, c := range corners {
+            var err os.Error
+            if v[j], err = strconv.Atoi(c); err != nil {
+                return nil, err
+            }
+        }
+        rects[i] = image.Rect(v[0], v[1], v[2], v[3])
+    }
+    return rects, nil
+}
+
+// RectMask returns a w x h mask of the pixels inside any of rects.
+func RectMask(w int, h int, rects []image.Rectangle) *FloatGray {
+    mask := NewFloatGray(w, h)
+    for _, r := range rects {
+        for y := r.Min.Y; y < r.Max.Y; y++ {
+            for x := r.Min.X; x < r.Max.X; x++ {
+                mask.SetFloatGray(x, y, FloatGrayColor{1})
+            }
+        }
+    }
+    return mask
+}
+
+// TissueMask detects the tissue of a bright field slide. The brightness of
+// the darkest channel of every pixel is split into tissue and white glass
+// with Otsu's threshold, but not below TissueBrightness so that slides
+// without glass are kept whole. The tissue is then closed with radius to
+// join nearby pieces and its holes are filled.
+func TissueMask(input *image.RGBA, radius int) *FloatGray {
+    w, h := input.Rect.Dx(), input.Rect.Dy()
+    brightness := NewFloatGray(w, h)
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            c := input.Pix[y*input.Stride+x]
+            v := c.R
+            if c.G < v {
+                v = c.G
+            }
+            if c.B < v {
+                v = c.B
+            }
+            brightness.Pix[y*brightness.Stride+x].Y = Float(v) / 255
+        }
+    }
+
+    threshold, err := brightness.AutoThreshold(ThresholdOtsu, 0)
+    if err != nil || threshold < TissueBrightness {
+        threshold = TissueBrightness
+    }
+    mask := brightness.MatchMask(threshold)
+    if radius > 0 {
+        mask = mask.Closed(radius)
+    }
+    return mask.HolesFilled()
+}
+
+// Intersected returns the mask of the pixels inside both p and q.
+func (p *FloatGray) Intersected(q *FloatGray) *FloatGray {
+    mask := NewFloatGray(p.Rect.Dx(), p.Rect.Dy())
+    for i, c := range p.Pix {
+        if c.Y != 0 && q.Pix[i].Y != 0 {
+            mask.Pix[i].Y = 1
+        }
+    }
+    return mask
+}
+
+// computeRect is computeRect narrowed to the bounds of p.Mask.
+func (p SIVQParameters) computeRect(reach int, w int, h int) image.Rectangle {
+    rect := computeRect(p.Border, reach, w, h)
+    if p.Mask == nil {
+        return rect
+    }
+    var bounds image.Rectangle
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            if p.Mask.Pix[y*p.Mask.Stride+x].Y == 0 {
+                continue
+            }
+            pixel := image.Rect(x, y, x+1, y+1)
+            if bounds.Empty() {
+                bounds = pixel
+            } else {
+                bounds = bounds.Union(pixel)
+            }
+        }
+    }
+    rect = rect.Intersect(bounds)
+    if rect.Empty() {
+        return image.Rectangle{}
+    }
+    return rect
+}
+
+// masked reports whether (x, y) is outside p.Mask and thus not compared.
+func (p SIVQParameters) masked(x int, y int) bool {
+    return p.Mask != nil && p.Mask.Pix[y*p.Mask.Stride+x].Y == 0
+}
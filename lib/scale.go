@@ -0,0 +1,115 @@
+package sivq
+
+import (
+    "os"
+)
+
+// ParseScales parses comma separated scales such as "0.5,1,2".
+func ParseScales(s string) ([]Float, os.Error) {
+    scales, err := parseFloats(s)
+    if err != nil {
+        return nil, err
+    }
+    for _, scale := range scales {
+        if scale <= 0 {
+            return nil, os.NewError("sivq: scales must be positive")
+        }
+    }
+    return scales, nil
+}
+
+// Scaled returns a copy of rv with every ring radius multiplied by scale.
+// The ring data is resampled around the ring to the samples of the new
+// radius, which is exact in angle for the interpolated samplers and an
+// approximation for bresenham.
+func (rv *RingVector) Scaled(scale Float) *RingVector {
+    c := rv.sampler()
+    nrv := &RingVector{ColorSpace: rv.ColorSpace, Channels: rv.Channels, Weights: rv.Weights,
+        Sampler: rv.Sampler, Samples: rv.Samples, sampling: c}
+    nrv.Rings = make([]RingVectorRing, len(rv.Rings))
+    for i, r := range rv.Rings {
+        radius := int(Float(r.Radius)*scale + 0.5)
+        if radius < 1 && r.Radius > 0 {
+            radius = 1
+        }
+        nr := newRing(c, radius, r.Stride)
+        resampleRing(nr.Data, r.Data, r.Stride)
+        nrv.Rings[i] = *nr
+        nrv.TotalDataCount += len(nr.Data)
+
+        if i == 0 || radius < nrv.MinRadius {
+            nrv.MinRadius = radius
+        }
+        if radius > nrv.MaxRadius {
+            nrv.MaxRadius = radius
+        }
+    }
+    return nrv
+}
+
+// resampleRing fills dst with the circular data of src, linearly
+// interpolating between the samples.
+func resampleRing(dst []Float, src []Float, stride int) {
+    n := len(src) / stride
+    m := len(dst) / stride
+    if n == m {
+        copy(dst, src)
+        return
+    }
+    for j := 0; j < m; j++ {
+        pos := Float(j) * Float(n) / Float(m)
+        i0 := int(pos)
+        t := pos - Float(i0)
+        i1 := (i0 + 1) % n
+        for c := 0; c < stride; c++ {
+            dst[j*stride+c] = (1-t)*src[i0*stride+c] + t*src[i1*stride+c]
+        }
+    }
+}
+
+// scaleLevel is one of the reference vectors of a run at one of the
+// searched scales.
+type scaleLevel struct {
+    vector  int    // index of the vector in the run
+    first   bool   // first level of the vector
+    scale   Float
+    input   source // image the vector is compared against
+    rv      *RingVector
+    reach   int
+    matcher *matcher
+    table   *RingTable
+}
+
+// newScaleLevels prepares every vector for matching at every scale of
+// p.Scales, or at the original scale when none are given. inputs[i] is the
+// image vectors[i] is compared against.
+func newScaleLevels(vectors []*RingVector, inputs []source, p SIVQParameters) []*scaleLevel {
+    scales := p.Scales
+    if len(scales) == 0 {
+        scales = []Float{1}
+    }
+    var levels []*scaleLevel
+    for v, rv := range vectors {
+        for i, scale := range scales {
+            srv := rv
+            if scale != 1 {
+                srv = rv.Scaled(scale)
+            }
+            levels = append(levels, &scaleLevel{vector: v, first: i == 0, scale: scale,
+                input: inputs[v], rv: srv, reach: srv.reach(),
+                matcher: newMatcher(srv, p), table: srv.Table(inputs[v].stride())})
+        }
+    }
+    return levels
+}
+
+// maxReach returns how far from the center the rings of any level reach.
+func maxReach(levels []*scaleLevel) int {
+    reach := 0
+    for _, level := range levels {
+        if level.reach > reach {
+            reach = level.reach
+        }
+    }
+    return reach
+}
@@ -0,0 +1,731 @@
+// Package sivq implements Spatially Invariant Vector Quantization.
+//
+// A RingVector is sampled from an image at a chosen location and then
+// compared, under all rotations, against every pixel of an input image.
+// The result is a FloatGray distance map where 0.0 is a perfect match.
+package sivq
+
+import (
+    "image"
+    "math"
+    "os"
+    "runtime"
+    "sync"
+)
+
+var (
+    circle Circle
+)
+
+func init() {
+    circle = NewBresenham()
+}
+
+// Float is the floating point type used for all ring data and results.
+type Float float32
+
+type RingVectorParameters struct {
+    Radius     int     // initial radius
+    Count      int     // how many rings
+    RadiusInc  int     // how much ring changes size
+    ColorSpace string  // name of the color space, "" for rgb
+    Channels   int     // values per pixel, 0 for the channels of the color space
+    Weights    []Float // channel weights, missing ones are 1
+    Sampler    string  // name of the ring sampler, "" for bresenham
+    Samples    int     // samples per ring for interpolated samplers, 0 for one per pixel of the largest ring
+}
+
+type SIVQParameters struct {
+    GammaAdjustment     Float           // for making images darker
+    AverageBias         Float           // for using average around instead of center
+    RotationStride      Float           // for calculating all possible rotations
+    ExactRotation       bool            // compare all rotations exactly using FFT correlation, RMS only
+    Mirror              bool            // also compare the mirror image of the vector
+    Scales              []Float         // scales of the vector radii to search, nil for only the original
+    Orientation         bool            // also return the rotation angle of the best match
+    TopK                int             // number of best vectors returned per pixel by RunVectors
+    Metric              Metric          // distance between rings, nil for RMS
+    MatchingStride      int             // for comparing less values
+    MatchingOffset      int             // for using different colors as comparison
+    Threshold           Float           // minimal value to be show on output
+    ThresholdMethod     ThresholdMethod // chooses Threshold from the distances unless ThresholdManual
+    ThresholdPercentile Float           // fraction of the pixels kept by ThresholdPercentile
+    Workers             int             // goroutines used, 0 for GOMAXPROCS
+    ChunkRows           int             // rows a worker takes at a time, 0 for DefaultChunkRows
+    Border              BorderMode      // how rings outside of the image are sampled
+    BorderValue         Float           // sampled value outside the image for BorderConstant
+    Mask                *FloatGray      // pixels compared where not 0, nil for all
+    ProgressCallback    func(Progress)
+}
+
+type RingVectorRing struct {
+    Radius   int
+    Stride   int // values per pixel
+    Data     []Float
+    Variance []Float // variance of every value of a learned prototype, nil otherwise
+}
+
+type RingVector struct {
+    MinRadius      int
+    MaxRadius      int
+    TotalDataCount int
+    Rings          []RingVectorRing
+    ColorSpace     string  // color space of the ring data, "" for rgb
+    Channels       int     // values per pixel, 0 in vectors saved before it existed
+    Weights        []Float // weights the channels were multiplied with
+    Sampler        string  // ring sampler the data was sampled with, "" for bresenham
+    Samples        int     // samples per ring of interpolated samplers
+    Examples       int     // number of samples a prototype was learned from, 0 for one
+
+    sampling  Circle
+    tableLock sync.Mutex
+    tables    map[int]*RingTable
+    sum       []Float // per channel sums of interpolated samples, reused between pixels
+}
+
+
+// NewRing returns a ring with three channels.
+func NewRing(radius int) *RingVectorRing {
+    return NewRingChannels(radius, 3)
+}
+
+// NewRingChannels returns a ring storing channels values per pixel.
+func NewRingChannels(radius int, channels int) *RingVectorRing {
+    return newRing(circle, radius, channels)
+}
+
+func newRing(c Circle, radius int, channels int) *RingVectorRing {
+    r := RingVectorRing{Radius: radius, Stride: channels}
+    pixelCount := c.GetPixelCount(radius)
+    r.Data = make([]Float, pixelCount*channels)
+    return &r
+}
+
+// LoadData samples the ring around (X, Y) as RGB values. Pixels outside of
+// the image are clamped to its edges.
+func (r *RingVectorRing) LoadData(input *image.RGBA, X int, Y int) {
+    r.loadBorder(input, newRGBConverter(), circle, X, Y, BorderClamp, 0)
+}
+
+// LoadDataGray samples the ring around (X, Y) from a FloatGray. Pixels
+// outside of the image are clamped to its edges.
+func (r *RingVectorRing) LoadDataGray(input *FloatGray, X int, Y int) {
+    r.loadBorderGray(input, circle, X, Y, BorderClamp, 0)
+}
+
+func NewRingVector(rvp RingVectorParameters) *RingVector {
+    channels := rvp.Channels
+    if channels <= 0 {
+        channels = 3
+        if cs, err := ParseColorSpace(rvp.ColorSpace); err == nil {
+            channels = cs.Channels()
+        }
+    }
+
+    rv := RingVector{}
+    rv.Sampler = rvp.Sampler
+    rv.Samples = rvp.Samples
+    if interpolated(rv.Sampler) {
+        // the same samples on every ring make rotation steps uniform
+        rv.Samples = ringSamples(rvp.Samples, rvp.Radius+(rvp.Count-1)*rvp.RadiusInc)
+    }
+    c := rv.sampler()
+    rv.Rings = make([]RingVectorRing, rvp.Count)
+    rv.TotalDataCount = 0
+    radius := rvp.Radius
+    rv.MinRadius = radius
+    for i := range rv.Rings {
+        rv.Rings[i] = *newRing(c, radius, channels)
+        rv.TotalDataCount += len(rv.Rings[i].Data)
+        radius += rvp.RadiusInc
+    }
+    rv.MaxRadius = radius - rvp.RadiusInc
+    rv.ColorSpace = rvp.ColorSpace
+    rv.Channels = channels
+    rv.Weights = rvp.Weights
+    return &rv
+}
+
+// channels returns the number of values per pixel in the rings of rv.
+func (rv *RingVector) channels() int {
+    if rv.Channels > 0 {
+        return rv.Channels
+    }
+    if len(rv.Rings) > 0 {
+        return rv.Rings[0].Stride
+    }
+    return 3
+}
+
+func (rv *RingVector) EmptyClone() *RingVector {
+    return rv.emptyClone(rv.channels())
+}
+
+// emptyClone returns an empty RingVector with the rings of rv, storing
+// channels values per pixel.
+func (rv *RingVector) emptyClone(channels int) *RingVector {
+    nrv := RingVector{}
+    nrv.MinRadius = rv.MinRadius
+    nrv.MaxRadius = rv.MaxRadius
+    nrv.ColorSpace = rv.ColorSpace
+    nrv.Channels = channels
+    nrv.Weights = rv.Weights
+    nrv.Sampler = rv.Sampler
+    nrv.Samples = rv.Samples
+    nrv.sampling = rv.sampler()
+    nrv.Rings = make([]RingVectorRing, len(rv.Rings))
+    for i := range rv.Rings {
+        nrv.Rings[i] = *newRing(nrv.sampling, rv.Rings[i].Radius, channels)
+        nrv.TotalDataCount += len(nrv.Rings[i].Data)
+    }
+    return &nrv
+}
+
+
+// Clone returns a copy of rv with its own ring data.
+func (rv *RingVector) Clone() *RingVector {
+    nrv := rv.EmptyClone()
+    nrv.Examples = rv.Examples
+    for i, r := range rv.Rings {
+        copy(nrv.Rings[i].Data, r.Data)
+        if r.Variance != nil {
+            nrv.Rings[i].Variance = make([]Float, len(r.Variance))
+            copy(nrv.Rings[i].Variance, r.Variance)
+        }
+    }
+    return nrv
+}
+
+// sampler returns the Circle the rings of rv are sampled with. Unknown
+// samplers fall back to bresenham, Run reports them as errors.
+func (rv *RingVector) sampler() Circle {
+    if rv.sampling == nil {
+        c, err := ParseSampler(rv.Sampler, rv.Samples)
+        if err != nil {
+            c = circle
+        }
+        rv.sampling = c
+    }
+    return rv.sampling
+}
+
+// reach returns how far from the center the rings of rv sample the image,
+// including the pixels used for interpolation.
+func (rv *RingVector) reach() int {
+    c := rv.sampler()
+    reach := 0
+    for _, r := range rv.Rings {
+        if v := ringReach(c, r.Radius); v > reach {
+            reach = v
+        }
+    }
+    return reach
+}
+
+// LoadData samples all rings around (X, Y) in the color space of rv.
+// Pixels outside of the image are clamped to its edges.
+func (rv *RingVector) LoadData(input *image.RGBA, X int, Y int) {
+    rv.loadBorder(input, rv.converter(), X, Y, BorderClamp, 0)
+}
+
+// LoadDataGray samples all rings around (X, Y) from a FloatGray. Pixels
+// outside of the image are clamped to its edges.
+func (rv *RingVector) LoadDataGray(input *FloatGray, X int, Y int) {
+    rv.loadBorderGray(input, X, Y, BorderClamp, 0)
+}
+
+func (rv *RingVector) Average() Float {
+    var avg Float
+    avg = 0.0
+    count := 0
+    for _, r := range rv.Rings {
+        for _, val := range r.Data {
+           if IsNotComputed(val) {
+               continue
+           }
+           count += 1
+           avg += val
+        }
+    }
+    if count == 0 {
+        return NotComputed()
+    }
+    avg = avg / Float(count)
+    return avg
+}
+
+type RingDiff struct {
+    Base   int
+    Diff   Float
+    Weight Float
+}
+
+// Diff returns the distance between A and B for the best rotation of B,
+// measured with p.Metric. With p.ExactRotation and the RMS metric all
+// rotations are compared; for many comparisons against the same A, Run
+// precomputes this only once.
+func (A *RingVector) Diff(B *RingVector, p SIVQParameters) Float {
+    return A.Match(B, p).Distance
+}
+
+// Match is Diff that, with p.Mirror, also compares the rotations of the
+// mirror image of B and reports which one matched best.
+func (A *RingVector) Match(B *RingVector, p SIVQParameters) Match {
+    m := newMatcher(A, p)
+    if m.prepare != nil {
+        B = B.Clone()
+    }
+    return m.newWorker()(B)
+}
+
+// prepared returns a copy of rv transformed by pr.
+func (rv *RingVector) prepared(pr preparer) *RingVector {
+    nrv := rv.Clone()
+    for _, r := range nrv.Rings {
+        pr.Prepare(r.Data, r.Stride)
+    }
+    return nrv
+}
+
+// diff is Diff for rings that have already been prepared for metric. It
+// also returns the rotation of the best match.
+func (A *RingVector) diff(B *RingVector, p SIVQParameters, metric Metric) (best Float, bestRotation Float) {
+    best = Float(math.Inf(1))
+    cutoff := p.cutoff(metric)
+
+    cache := make([]*RingDiff, len(A.Rings))
+    for ri := range A.Rings {
+        cache[ri] = &RingDiff{Base: -1}
+    }
+
+    for rotation := Float(0.0); rotation < Tau; rotation += p.RotationStride {
+        total := Float(0.0)
+        totalWeight := Float(0.0)
+        for ri := range A.Rings {
+            dA := A.Rings[ri].Data
+            dB := B.Rings[ri].Data
+
+            stride := A.Rings[ri].Stride
+            dataCount := len(dA)
+
+            base := rotationBase(rotation, dataCount, stride)
+
+            cacheVal := cache[ri]
+            if cacheVal.Base != base {
+                cacheVal.Base = base
+                cacheVal.Diff, cacheVal.Weight = metric.Ring(dA, dB, base, p)
+            }
+
+            total += cacheVal.Diff
+            totalWeight += cacheVal.Weight
+        }
+        total = metric.Finish(total, totalWeight)
+        if best > total {
+            best = total
+            bestRotation = rotation
+        }
+        if best <= cutoff {
+            break
+        }
+    }
+    return best, bestRotation
+}
+
+// rotationBase returns the index of the value of a ring with count values
+// that is compared against its first value at rotation. Angles of whole
+// pixel steps are not exact in floating point, so they are rounded onto
+// their pixel.
+func rotationBase(rotation Float, count int, stride int) int {
+    base := int((rotation/Tau)*Float(count) + 0.001)
+    base = base - base%stride
+    return base % count
+}
+
+// DefaultChunkRows is the number of rows a worker takes at a time when
+// SIVQParameters.ChunkRows is not set.
+const DefaultChunkRows = 8
+
+// forEachRow calls the row function of a worker for every row in
+// [startAtY, stopAtY) using a bounded pool of p.Workers goroutines and waits
+// until all rows are done or ctx is canceled. newWorker is called once per
+// goroutine so that buffers can be reused between rows.
+func forEachRow(ctx Context, tracker *progressTracker, p SIVQParameters, startAtY int, stopAtY int, newWorker func() func(y int)) {
+    if stopAtY <= startAtY {
+        return
+    }
+
+    workers := p.Workers
+    if workers <= 0 {
+        workers = runtime.GOMAXPROCS(0)
+    }
+    chunkRows := p.ChunkRows
+    if chunkRows <= 0 {
+        chunkRows = DefaultChunkRows
+    }
+
+    chunkCount := (stopAtY - startAtY + chunkRows - 1) / chunkRows
+    if workers > chunkCount {
+        workers = chunkCount
+    }
+    chunks := make(chan int, chunkCount)
+    for y := startAtY; y < stopAtY; y += chunkRows {
+        chunks <- y
+    }
+    close(chunks)
+
+    done := make(chan int, workers)
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            row := newWorker()
+            for start := range chunks {
+                for y := start; y < start+chunkRows && y < stopAtY; y++ {
+                    if stopped(ctx) {
+                        return
+                    }
+                    row(y)
+                    done <- y
+                }
+            }
+        }()
+    }
+    go func() {
+        wg.Wait()
+        close(done)
+    }()
+
+    for _ = range done {
+        if ctx.Err() == nil {
+            tracker.rowDone()
+        }
+    }
+}
+
+// stopped reports whether ctx has been canceled without blocking.
+func stopped(ctx Context) bool {
+    select {
+    case <-ctx.Done():
+        return true
+    default:
+    }
+    return false
+}
+
+func calculateSIVQ(ctx Context, tracker *progressTracker, p SIVQParameters, output *Result, vectors int, levels []*scaleLevel) {
+    w := output.Distance.Bounds().Dx()
+    h := output.Distance.Bounds().Dy()
+    rect := p.computeRect(maxReach(levels), w, h)
+
+    forEachRow(ctx, tracker, p, rect.Min.Y, rect.Max.Y, func() func(y int) {
+        buffers := make([]*RingVector, len(levels))
+        matches := make([]func(B *RingVector) Match, len(levels))
+        for i, level := range levels {
+            buffers[i] = level.rv.EmptyClone()
+            matches[i] = level.matcher.newWorker()
+        }
+        best := make([]Match, vectors)
+        bestScale := make([]Float, vectors)
+        order := make([]int, vectors)
+        return func(y int) {
+            for x := rect.Min.X; x < rect.Max.X; x++ {
+                if stopped(ctx) {
+                    return
+                }
+                if p.masked(x, y) {
+                    continue
+                }
+                for i, level := range levels {
+                    r := buffers[i]
+                    if inside(x, y, w, h, level.reach) {
+                        level.input.loadTable(r, level.table, x, y)
+                    } else {
+                        level.input.loadBorder(r, x, y, p.Border, p.BorderValue)
+                    }
+                    m := matches[i](r)
+                    v := level.vector
+                    if level.first || m.Distance < best[v].Distance {
+                        best[v], bestScale[v] = m, level.scale
+                    }
+                }
+                rankMatches(order, best)
+                output.set(x, y, best, bestScale, order)
+            }
+        }
+    })
+}
+
+// rankMatches sorts the indices of matches into order, best match first.
+func rankMatches(order []int, matches []Match) {
+    for i := range order {
+        order[i] = i
+        for j := i; j > 0 && matches[order[j]].Distance < matches[order[j-1]].Distance; j-- {
+            order[j], order[j-1] = order[j-1], order[j]
+        }
+    }
+}
+
+// set stores the best of the vector matches at (x, y) into the maps of r.
+func (r *Result) set(x int, y int, matches []Match, scales []Float, order []int) {
+    v := order[0]
+    best := matches[v]
+    r.Distance.Set(x, y, FloatGrayColor{best.Distance})
+    if r.Mirrored != nil {
+        mirrored := Float(0)
+        if best.Mirrored {
+            mirrored = 1
+        }
+        r.Mirrored.Set(x, y, FloatGrayColor{mirrored})
+    }
+    if r.Scale != nil {
+        r.Scale.Set(x, y, FloatGrayColor{scales[v]})
+    }
+    if r.Rotation != nil {
+        r.Rotation.Set(x, y, FloatGrayColor{best.Rotation})
+    }
+    if r.Label != nil {
+        r.Label.Set(x, y, FloatGrayColor{Float(v)})
+    }
+    for i := range r.TopLabels {
+        r.TopLabels[i].Set(x, y, FloatGrayColor{Float(order[i])})
+        r.TopDistances[i].Set(x, y, FloatGrayColor{matches[order[i]].Distance})
+    }
+}
+
+func fixCircleDefects(ctx Context, tracker *progressTracker, p SIVQParameters, input *FloatGray, output *FloatGray, rv *RingVector) {
+    w := output.Bounds().Dx()
+    h := output.Bounds().Dy()
+    reach := rv.reach()
+    rect := p.computeRect(reach, w, h)
+
+    table := rv.Table(input.Stride)
+    forEachRow(ctx, tracker, p, rect.Min.Y, rect.Max.Y, func() func(y int) {
+        r := rv.emptyClone(1)
+        return func(y int) {
+            for x := rect.Min.X; x < rect.Max.X; x++ {
+                if stopped(ctx) {
+                    return
+                }
+                if p.masked(x, y) {
+                    continue
+                }
+                if inside(x, y, w, h, reach) {
+                    r.loadTableGray(input, table, x, y)
+                } else {
+                    // distances outside the image are unknown
+                    r.loadBorderGray(input, x, y, p.Border, NotComputed())
+                }
+                inY := input.At(x,y).(FloatGrayColor).Y
+                output.Set(x, y, 
+                    FloatGrayColor{ (p.AverageBias * r.Average()) + (1.0 - p.AverageBias) * inY } )
+            }
+        }
+    })
+}
+
+// SIVQ runs DistanceMap and renders the result with the gamma and threshold
+// from the parameters. An automatic threshold without computed distances
+// falls back to p.Threshold.
+func SIVQ(p SIVQParameters, input *image.RGBA, rv *RingVector) (*image.RGBA, os.Error) {
+    distances, err := DistanceMap(p, input, rv)
+    if err != nil {
+        return nil, err
+    }
+    threshold, err := p.OutputThreshold(distances)
+    if err != nil {
+        threshold = p.Threshold
+    }
+    return distances.ToRGBA(p.GammaAdjustment, threshold), nil
+}
+
+// DistanceMap compares rv against every pixel of input and returns the
+// unmodified distances, 0.0 being a perfect match. GammaAdjustment and
+// Threshold are not applied. Pixels that were not compared, such as the
+// border with BorderSkip, are NotComputed. The parameters, vector and
+// input are checked as by Run.
+func DistanceMap(p SIVQParameters, input *image.RGBA, rv *RingVector) (*FloatGray, os.Error) {
+    return Run(Background(), p, input, rv)
+}
+
+// Result holds the per pixel maps of a run. Maps that were not requested
+// are nil.
+type Result struct {
+    Distance     *FloatGray   // distance of the best match, see DistanceMap
+    Mirrored     *FloatGray   // 1 where the best match was mirrored, with SIVQParameters.Mirror
+    Scale        *FloatGray   // scale of the best match, with SIVQParameters.Scales
+    Rotation     *FloatGray   // angle of the best match in radians, with SIVQParameters.Orientation
+    Label        *FloatGray   // index of the best matching vector, with RunVectors
+    TopLabels    []*FloatGray // index of the i-th best vector, with SIVQParameters.TopK
+    TopDistances []*FloatGray // distance of the i-th best vector, with SIVQParameters.TopK
+}
+
+// Run is DistanceMap that can be canceled with ctx. When ctx is canceled
+// Run stops promptly and returns the partially computed distance map
+// together with ctx.Err().
+func Run(ctx Context, p SIVQParameters, input *image.RGBA, rv *RingVector) (*FloatGray, os.Error) {
+    res, err := RunResult(ctx, p, input, rv)
+    if res == nil {
+        return nil, err
+    }
+    return res.Distance, err
+}
+
+// RunResult is Run returning all maps of the Result.
+func RunResult(ctx Context, p SIVQParameters, input *image.RGBA, rv *RingVector) (*Result, os.Error) {
+    return runRGBA(ctx, p, input, []*RingVector{rv}, false)
+}
+
+// RunVectors compares every pixel of input against all vectors in a single
+// pass. The Distance of the Result is the smallest distance of any vector
+// and Label the index of that vector. The maps of the AverageBias pass
+// are calculated using the rings of the first vector.
+func RunVectors(ctx Context, p SIVQParameters, input *image.RGBA, vectors []*RingVector) (*Result, os.Error) {
+    return runRGBA(ctx, p, input, vectors, true)
+}
+
+func runRGBA(ctx Context, p SIVQParameters, input *image.RGBA, vectors []*RingVector, labels bool) (*Result, os.Error) {
+    inputs := make([]source, len(vectors))
+    for i, rv := range vectors {
+        cs, err := ParseColorSpace(rv.ColorSpace)
+        if err != nil {
+            return nil, err
+        }
+        if cs.Channels() != rv.channels() {
+            return nil, os.NewError("sivq: ring vector channels do not match its color space")
+        }
+        inputs[i] = &rgbaSource{input, rv.converter()}
+    }
+    return run(ctx, p, inputs, vectors, labels)
+}
+
+// RunMulti is Run for images with an arbitrary number of channels. The
+// channel count of input and rv must be the same.
+func RunMulti(ctx Context, p SIVQParameters, input *MultiImage, rv *RingVector) (*FloatGray, os.Error) {
+    res, err := RunMultiResult(ctx, p, input, rv)
+    if res == nil {
+        return nil, err
+    }
+    return res.Distance, err
+}
+
+// RunMultiResult is RunMulti returning all maps of the Result.
+func RunMultiResult(ctx Context, p SIVQParameters, input *MultiImage, rv *RingVector) (*Result, os.Error) {
+    return runMulti(ctx, p, input, []*RingVector{rv}, false)
+}
+
+// RunMultiVectors is RunVectors for images with an arbitrary number of
+// channels.
+func RunMultiVectors(ctx Context, p SIVQParameters, input *MultiImage, vectors []*RingVector) (*Result, os.Error) {
+    return runMulti(ctx, p, input, vectors, true)
+}
+
+func runMulti(ctx Context, p SIVQParameters, input *MultiImage, vectors []*RingVector, labels bool) (*Result, os.Error) {
+    inputs := make([]source, len(vectors))
+    for i, rv := range vectors {
+        if input.Channels != rv.channels() {
+            return nil, os.NewError("sivq: ring vector and image have different channel counts")
+        }
+        inputs[i] = &multiSource{input, rv.Weights}
+    }
+    return run(ctx, p, inputs, vectors, labels)
+}
+
+// normalized returns p with the values that are out of range for the
+// vectors replaced by the nearest usable ones.
+func (p SIVQParameters) normalized(vectors ...*RingVector) SIVQParameters {
+    if len(vectors) > 0 {
+        minStride := Tau
+        for _, rv := range vectors {
+            for _, r := range rv.Rings {
+                stride := Tau * Float(r.Stride) / Float(len(r.Data))
+                if minStride > stride {
+                    minStride = stride
+                }
+            }
+        }
+        if p.RotationStride < minStride {
+            p.RotationStride = minStride
+        }
+    }
+    if p.MatchingStride <= 0 {
+        p.MatchingStride = 1
+    }
+    
+    if p.AverageBias > 1.0 {
+        p.AverageBias = 1.0
+    } else if p.AverageBias < 0.0 {
+        p.AverageBias = 0.0
+    }
+    if p.TopK < 0 {
+        p.TopK = 0
+    }
+    return p
+}
+
+func run(ctx Context, p SIVQParameters, inputs []source, vectors []*RingVector, labels bool) (*Result, os.Error) {
+    if len(vectors) == 0 {
+        return nil, os.NewError("sivq: no ring vectors")
+    }
+    for _, rv := range vectors {
+        if _, err := ParseSampler(rv.Sampler, rv.Samples); err != nil {
+            return nil, err
+        }
+    }
+    if err := p.checkExact(); err != nil {
+        return nil, err
+    }
+    if p.ProgressCallback == nil { 
+        p.ProgressCallback = func(pr Progress){}
+    }
+    // the rotation stride is normalized for every vector by its matcher
+    p = p.normalized()
+    if p.TopK > len(vectors) {
+        p.TopK = len(vectors)
+    }
+    fixDefects := p.AverageBias >= 0.001
+    
+    dx := inputs[0].Bounds().Dx()
+    dy := inputs[0].Bounds().Dy()
+    if p.Mask != nil && (p.Mask.Rect.Dx() != dx || p.Mask.Rect.Dy() != dy) {
+        return nil, os.NewError("sivq: mask and image have different sizes")
+    }
+
+    levels := newScaleLevels(vectors, inputs, p)
+    rows := p.computeRect(maxReach(levels), dx, dy).Dy()
+    if fixDefects {
+        rows += p.computeRect(vectors[0].reach(), dx, dy).Dy()
+    }
+    tracker := newProgressTracker(p.ProgressCallback, rows)
+    
+    res := &Result{Distance: newNotComputedMap(dx, dy)}
+    if p.Mirror {
+        res.Mirrored = newNotComputedMap(dx, dy)
+    }
+    if len(p.Scales) > 0 {
+        res.Scale = newNotComputedMap(dx, dy)
+    }
+    if p.Orientation {
+        res.Rotation = newNotComputedMap(dx, dy)
+    }
+    if labels {
+        res.Label = newNotComputedMap(dx, dy)
+    }
+    for i := 0; i < p.TopK; i++ {
+        res.TopLabels = append(res.TopLabels, newNotComputedMap(dx, dy))
+        res.TopDistances = append(res.TopDistances, newNotComputedMap(dx, dy))
+    }
+    calculateSIVQ(ctx, tracker, p, res, len(vectors), levels)
+    if err := ctx.Err(); err != nil || !fixDefects {
+        return res, err
+    }
+
+    temp := res.Distance
+    res.Distance = newNotComputedMap(dx, dy)
+    fixCircleDefects(ctx, tracker, p, temp, res.Distance, vectors[0])
+    if err := ctx.Err(); err != nil {
+        res.Distance = temp
+        return res, err
+    }
+    return res, nil
+}
@@ -0,0 +1,59 @@
+package sivq
+
+import (
+    "image"
+)
+
+// source is an input image that ring data is sampled from.
+type source interface {
+    Bounds() image.Rectangle
+    // stride returns the number of pixels in a row
+    stride() int
+    // loadTable samples all rings of rv around (X, Y) using offsets from t.
+    loadTable(rv *RingVector, t *RingTable, X int, Y int)
+    // loadBorder samples all rings of rv around (X, Y) when they may reach
+    // outside of the image.
+    loadBorder(rv *RingVector, X int, Y int, mode BorderMode, value Float)
+}
+
+// rgbaSource samples an RGBA image converted into a color space.
+type rgbaSource struct {
+    img  *image.RGBA
+    conv *colorConverter
+}
+
+func (s *rgbaSource) Bounds() image.Rectangle { return s.img.Bounds() }
+func (s *rgbaSource) stride() int             { return s.img.Stride }
+
+func (s *rgbaSource) loadTable(rv *RingVector, t *RingTable, X int, Y int) {
+    rv.loadTable(s.img, t, s.conv, X, Y)
+}
+
+func (s *rgbaSource) loadBorder(rv *RingVector, X int, Y int, mode BorderMode, value Float) {
+    rv.loadBorder(s.img, s.conv, X, Y, mode, value)
+}
+
+// multiSource samples a MultiImage with channel weights.
+type multiSource struct {
+    img     *MultiImage
+    weights []Float
+}
+
+func (s *multiSource) Bounds() image.Rectangle { return s.img.Rect }
+func (s *multiSource) stride() int             { return s.img.Stride }
+
+func (s *multiSource) loadTable(rv *RingVector, t *RingTable, X int, Y int) {
+    center := Y*s.img.Stride + X
+    sum := rv.sumBuffer(s.img.Channels)
+    for i := range rv.Rings {
+        rv.Rings[i].loadTableMulti(s.img, s.weights, center, t, sum)
+    }
+}
+
+func (s *multiSource) loadBorder(rv *RingVector, X int, Y int, mode BorderMode, value Float) {
+    c := rv.sampler()
+    sum := rv.sumBuffer(s.img.Channels)
+    for i := range rv.Rings {
+        rv.Rings[i].loadBorderMulti(s.img, s.weights, c, X, Y, mode, value, sum)
+    }
+}
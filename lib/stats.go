@@ -0,0 +1,86 @@
+package sivq
+
+import (
+    "math"
+    "sort"
+)
+
+// Statistics summarizes the values of a distance map.
+type Statistics struct {
+    Count  int
+    Min    Float
+    Max    Float
+    Mean   Float
+    StdDev Float
+}
+
+type floatSlice []Float
+
+func (s floatSlice) Len() int           { return len(s) }
+func (s floatSlice) Less(i, j int) bool { return s[i] < s[j] }
+func (s floatSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// Statistics calculates the minimum, maximum, mean and standard deviation
+// of all computed values in the image.
+func (p *FloatGray) Statistics() Statistics {
+    st := Statistics{}
+    st.Min = Float(math.Inf(1))
+    st.Max = Float(math.Inf(-1))
+
+    sum := 0.0
+    sumSq := 0.0
+    for _, c := range p.Pix {
+        if IsNotComputed(c.Y) {
+            continue
+        }
+        if c.Y < st.Min {
+            st.Min = c.Y
+        }
+        if c.Y > st.Max {
+            st.Max = c.Y
+        }
+        sum += float64(c.Y)
+        sumSq += float64(c.Y) * float64(c.Y)
+        st.Count += 1
+    }
+
+    if st.Count == 0 {
+        return Statistics{}
+    }
+    mean := sum / float64(st.Count)
+    variance := sumSq/float64(st.Count) - mean*mean
+    if variance < 0.0 {
+        variance = 0.0
+    }
+    st.Mean = Float(mean)
+    st.StdDev = Float(math.Sqrt(variance))
+    return st
+}
+
+// Percentiles returns the values below which the given fractions (0.0 - 1.0)
+// of the computed image values fall. The image itself is not modified.
+func (p *FloatGray) Percentiles(qs ...Float) []Float {
+    result := make([]Float, len(qs))
+
+    values := make(floatSlice, 0, len(p.Pix))
+    for _, c := range p.Pix {
+        if !IsNotComputed(c.Y) {
+            values = append(values, c.Y)
+        }
+    }
+    if len(values) == 0 {
+        return result
+    }
+    sort.Sort(values)
+
+    last := len(values) - 1
+    for i, q := range qs {
+        if q < 0.0 {
+            q = 0.0
+        } else if q > 1.0 {
+            q = 1.0
+        }
+        result[i] = values[int(q*Float(last)+0.5)]
+    }
+    return result
+}
@@ -0,0 +1,148 @@
+package sivq
+
+import (
+    "os"
+)
+
+// ThresholdMethod selects how the threshold of the output is chosen.
+type ThresholdMethod int
+
+const (
+    ThresholdManual     ThresholdMethod = iota // SIVQParameters.Threshold is used as given
+    ThresholdOtsu                              // maximizes the variance between the two classes of distances
+    ThresholdPercentile                        // keeps the SIVQParameters.ThresholdPercentile best matches
+    ThresholdTriangle                          // farthest histogram bin from the line from the peak to the best match
+)
+
+var thresholdMethodNames = []string{"manual", "otsu", "percentile", "triangle"}
+
+func (m ThresholdMethod) String() string {
+    if m < 0 || int(m) >= len(thresholdMethodNames) {
+        return "unknown"
+    }
+    return thresholdMethodNames[m]
+}
+
+// ParseThresholdMethod returns the ThresholdMethod with the given name.
+func ParseThresholdMethod(name string) (ThresholdMethod, os.Error) {
+    if name == "" {
+        return ThresholdManual, nil
+    }
+    for i, n := range thresholdMethodNames {
+        if n == name {
+            return ThresholdMethod(i), nil
+        }
+    }
+    return ThresholdManual, os.NewError("sivq: unknown threshold method " + name)
+}
+
+// ThresholdBins is the number of histogram bins of the automatic
+// thresholds.
+const ThresholdBins = 256
+
+// AutoThreshold chooses a distance with method from the computed values,
+// pixels with a distance up to it being matches. fraction is the part of
+// the pixels kept by ThresholdPercentile.
+func (p *FloatGray) AutoThreshold(method ThresholdMethod, fraction Float) (Float, os.Error) {
+    st := p.Statistics()
+    if st.Count == 0 {
+        return 0, os.NewError("sivq: no computed distances to threshold")
+    }
+    if method == ThresholdPercentile {
+        return p.Percentiles(fraction)[0], nil
+    }
+    if st.Max <= st.Min {
+        return st.Max, nil
+    }
+
+    width := (st.Max - st.Min) / ThresholdBins
+    histogram := make([]Float, ThresholdBins)
+    for _, c := range p.Pix {
+        if IsNotComputed(c.Y) {
+            continue
+        }
+        bin := int((c.Y - st.Min) / width)
+        if bin >= ThresholdBins {
+            bin = ThresholdBins - 1
+        }
+        histogram[bin]++
+    }
+
+    var bin int
+    switch method {
+    case ThresholdOtsu:
+        bin = otsu(histogram)
+    case ThresholdTriangle:
+        bin = triangle(histogram)
+    default:
+        return 0, os.NewError("sivq: no automatic threshold for " + method.String())
+    }
+    // the upper edge of the last bin of matches
+    return st.Min + Float(bin+1)*width, nil
+}
+
+// otsu returns the last bin of the first class of the split maximizing the
+// variance between the classes.
+func otsu(histogram []Float) int {
+    total, sum := Float(0), Float(0)
+    for i, n := range histogram {
+        total += n
+        sum += Float(i) * n
+    }
+
+    best, bestVariance := 0, Float(-1)
+    count, countSum := Float(0), Float(0)
+    for i, n := range histogram[:len(histogram)-1] {
+        count += n
+        countSum += Float(i) * n
+        if count == 0 || count == total {
+            continue
+        }
+        mean0 := countSum / count
+        mean1 := (sum - countSum) / (total - count)
+        variance := count * (total - count) * (mean0 - mean1) * (mean0 - mean1)
+        if variance > bestVariance {
+            best, bestVariance = i, variance
+        }
+    }
+    return best
+}
+
+// triangle returns the bin farthest below the line between the first bin
+// and the peak of the histogram. The matches are expected in the tail of
+// small distances, whatever the length of the other tail.
+func triangle(histogram []Float) int {
+    peak := 0
+    for i, n := range histogram {
+        if n > histogram[peak] {
+            peak = i
+        }
+    }
+    if peak == 0 {
+        return 0
+    }
+
+    // distance from the line up to a constant factor
+    best, bestDistance := 0, Float(-1)
+    for i := 0; i < peak; i++ {
+        d := Float(i)*(histogram[peak]-histogram[0]) - Float(peak)*(histogram[i]-histogram[0])
+        if d > bestDistance {
+            best, bestDistance = i, d
+        }
+    }
+    return best
+}
+
+// OutputThreshold returns the threshold to render distances with, which is
+// p.Threshold for ThresholdManual and the automatic threshold converted
+// with the gamma otherwise.
+func (p SIVQParameters) OutputThreshold(distances *FloatGray) (Float, os.Error) {
+    if p.ThresholdMethod == ThresholdManual {
+        return p.Threshold, nil
+    }
+    d, err := distances.AutoThreshold(p.ThresholdMethod, p.ThresholdPercentile)
+    if err != nil {
+        return 0, err
+    }
+    return DisplayThreshold(p.GammaAdjustment, d), nil
+}
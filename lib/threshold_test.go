@@ -0,0 +1,64 @@
+package sivq
+
+import (
+    "testing"
+)
+
+func TestAutoThreshold(t *testing.T) {
+    tests := []struct {
+        name     string
+        method   ThresholdMethod
+        fraction Float
+        values   []Float
+        matches  int // pixels up to the threshold
+    }{
+        {"otsu two levels", ThresholdOtsu, 0, []Float{0.8, 0.2, 0.8, 0.8, 0.2, 0.8, 0.8, 0.8}, 2},
+        {"otsu two clusters", ThresholdOtsu, 0, []Float{0.1, 0.75, 0.15, 0.7, 0.2, 0.8}, 3},
+        {"triangle tail", ThresholdTriangle, 0, []Float{0.9, 0, 0.9, 0.9, 0.1, 0.9, 0.9, 0.9, 0.9, 0.9, 0.9, 0.9}, 2},
+        {"triangle peak first", ThresholdTriangle, 0, []Float{0.1, 0.1, 0.9, 0.1, 0.1, 0.1}, 5},
+        {"percentile", ThresholdPercentile, 0.25, []Float{0.8, 0.1, 0.7, 0.2, 0.6, 0.3, 0.5, 0.4}, 3},
+        {"constant", ThresholdOtsu, 0, []Float{0.4, 0.4, 0.4}, 3},
+    }
+    for _, test := range tests {
+        threshold, err := grayImage(test.values).AutoThreshold(test.method, test.fraction)
+        if err != nil {
+            t.Errorf("%s: %s", test.name, err)
+            continue
+        }
+        matches := 0
+        for _, v := range test.values {
+            if v <= threshold {
+                matches++
+            }
+        }
+        if matches != test.matches {
+            t.Errorf("%s: threshold %g keeps %d pixels, want %d", test.name, threshold, matches, test.matches)
+        }
+    }
+}
+
+func TestAutoThresholdErrors(t *testing.T) {
+    if _, err := grayImage([]Float{NotComputed(), NotComputed()}).AutoThreshold(ThresholdOtsu, 0); err == nil {
+        t.Error("no error without computed distances")
+    }
+    if _, err := grayImage([]Float{0.1, 0.9}).AutoThreshold(ThresholdManual, 0); err == nil {
+        t.Error("no error for the manual method")
+    }
+}
+
+func TestOutputThreshold(t *testing.T) {
+    distances := grayImage([]Float{0.2, 0.2, 0.8, 0.8})
+    p := SIVQParameters{GammaAdjustment: 1, Threshold: 0.3}
+    if threshold, _ := p.OutputThreshold(distances); threshold != 0.3 {
+        t.Errorf("manual threshold %g, want 0.3", threshold)
+    }
+    p.ThresholdMethod = ThresholdOtsu
+    threshold, err := p.OutputThreshold(distances)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // drawn strengths are 1 - distance with a gamma of 1
+    if !(threshold <= 0.8 && threshold > 0.2) {
+        t.Errorf("otsu display threshold %g, want in (0.2, 0.8]", threshold)
+    }
+}
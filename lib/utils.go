@@ -1,4 +1,4 @@
-package main
+package sivq
 
 import (
     "exp/draw"
@@ -8,7 +8,8 @@ import (
 )
 
 
-func rgba(m image.Image) *image.RGBA {
+// ConvertRGBA returns m as *image.RGBA, converting it when needed.
+func ConvertRGBA(m image.Image) *image.RGBA {
     if r, ok := m.(*image.RGBA); ok {
         return r
     }
@@ -18,6 +18,8 @@ import (
     "runtime"
     "encoding/base64"
     "bytes"
+    "flag"
+    "sivq"
 )
 
 const (
@@ -26,6 +28,7 @@ const (
     VectorDir   = "img/vec/"
     TemplateDir = "template/"
     StaticDir   = "static/"
+    TissueClose = 5 // radius joining nearby pieces of detected tissue
 )
 
 type UploadResult struct {
@@ -34,33 +37,99 @@ type UploadResult struct {
     Image   string
 }
 
-type UploadPage struct {
-    VectorFiles string
+type TopResult struct {
+    Error   bool
+    Message string
+    Top     []string
 }
 
-type ProcessInput struct {
-    Image          string
-    VectorName     string
-    VecX           int
-    VecY           int
+type ThresholdResult struct {
+    Error     bool
+    Message   string
+    Threshold float64
+}
+
+type DetectionResult struct {
+    Error      bool
+    Message    string
+    Detections []sivq.Detection
+    CSV        string
+    JSON       string
+}
+
+type ContourResult struct {
+    Error    bool
+    Message  string
+    Contours int
+    GeoJSON  string
+    SVG      string
+}
+
+type OptimizeResult struct {
+    Error          bool
+    Message        string
     VectorRadius   int
     VectorRings    int
     RingSizeInc    int
-    Threshold      float64
-    RotationStride float64
+    Metric         string
     MatchStride    int
-    MatchingOffset int
-    GammaAdjust    float64
-    AverageBias    float64
+    RotationStride float64
+    Score          float64
+    Margin         float64
+}
+
+type UploadPage struct {
+    VectorFiles string
+}
+
+type ProcessInput struct {
+    Image               string
+    VectorName          string
+    VecX                int
+    VecY                int
+    VectorRadius        int
+    VectorRings         int
+    RingSizeInc         int
+    Threshold           float64
+    ThresholdMethod     string
+    ThresholdPercentile float64
+    RotationStride      float64
+    ExactRotation       bool
+    Mirror              bool
+    Scales              string
+    Orientation         bool
+    Colormap            string
+    Range               string
+    Overlay             float64
+    Detect              bool
+    Contours            bool
+    Simplify            float64
+    LabelVectors        string
+    TopK                int
+    Metric              string
+    ColorSpace          string
+    Weights             string
+    Sampler             string
+    Samples             int
+    MatchStride         int
+    MatchingOffset      int
+    GammaAdjust         float64
+    AverageBias         float64
+    Border              string
+    BorderValue         float64
+    ROI                 string
+    Tissue              bool
 }
 
 type Work struct {
     conn  *websocket.Conn
     input *ProcessInput
-    stopCh	chan bool
+    ctx   sivq.Context
 }
 
 var (
+    workers        = flag.Int("P", 4, "number of worker threads")
+    chunkRows      = flag.Int("C", sivq.DefaultChunkRows, "rows a worker processes at a time")
     uploadTemplate = template.MustParseFile(TemplateDir+"upload.html", nil)
     errorTemplate  = template.MustParseFile(TemplateDir+"error.html", nil)
     workChan       = make(chan Work)
@@ -128,7 +197,12 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
  */
 func imgHandler(w http.ResponseWriter, r *http.Request) {
     fileName := r.URL.Path[5:]
-    w.Header().Set("Content-Type", "image")
+    if strings.HasSuffix(fileName, ".svg") {
+        w.Header().Set("Content-Type", "image/svg+xml")
+    } else if !strings.HasSuffix(fileName, ".csv") && !strings.HasSuffix(fileName, ".json") &&
+        !strings.HasSuffix(fileName, ".geojson") {
+        w.Header().Set("Content-Type", "image")
+    }
     http.ServeFile(w, r, "img/"+fileName)
 }
 
@@ -149,8 +223,11 @@ func clientHandler(ws *websocket.Conn) {
         ws.Close()
     }()
 
-    buf := make([]byte, 256)
-    stopCh := make(chan bool)
+    // stops the work of this client when it leaves or asks to stop
+    ctx, cancel := sivq.WithCancel(sivq.Background())
+    defer cancel()
+
+    buf := make([]byte, 4096)
     var input ProcessInput
     for {
         n, err := ws.Read(buf)
@@ -161,11 +238,10 @@ func clientHandler(ws *websocket.Conn) {
         // get data
         err = json.Unmarshal(buf[0:n], &input)
         if err != nil {
-        	stopCh <- true
             break
         }
 
-        workChan <- Work{ws, &input, stopCh}
+        workChan <- Work{ws, &input, ctx}
     }
 }
 
@@ -180,7 +256,7 @@ func hub() {
 
 		work.conn.Write([]byte("0.01"))
 
-		err := process(work.input, work.conn, work.stopCh)
+		err := process(work.ctx, work.input, work.conn)
 
 		var response []byte
 		if (err == nil) {
@@ -252,7 +328,8 @@ func uploadErrorHandler(fn http.HandlerFunc) http.HandlerFunc {
  * Start server
  */
 func main() {
-    runtime.GOMAXPROCS(4)
+    flag.Parse()
+    runtime.GOMAXPROCS(*workers)
     fmt.Println("Server started.")
 
     go hub()
@@ -262,6 +339,7 @@ func main() {
     http.HandleFunc("/static/", errorHandler(staticHandler))
     http.HandleFunc("/img/", errorHandler(imgHandler))
     http.HandleFunc("/saveVector", uploadErrorHandler(saveVectorHandler))
+    http.HandleFunc("/optimize", uploadErrorHandler(optimizeHandler))
     http.Handle("/process", websocket.Handler(clientHandler))
     http.ListenAndServe(":8080", nil)
 }
@@ -269,7 +347,7 @@ func main() {
 /*
  * Process image
  */
-func process(input *ProcessInput, conn *websocket.Conn, stopCh chan bool) os.Error {
+func process(ctx sivq.Context, input *ProcessInput, conn *websocket.Conn) os.Error {
 	log.Println(input)
 
     // open input file
@@ -291,47 +369,170 @@ func process(input *ProcessInput, conn *websocket.Conn, stopCh chan bool) os.Err
     if err != nil {
         return err
     }
-    rgbaInput := rgba(inputImage)
-
-    sivqParams := SIVQParameters{
-        GammaAdjustment: float(input.GammaAdjust),
-        AverageBias:     float(input.AverageBias),
-        RotationStride:  float(input.RotationStride),
-        MatchingStride:  input.MatchStride,
-        MatchingOffset:  input.MatchingOffset,
-        Threshold:       float(input.Threshold),
-        ProgressCallback: func(p float) {
-            conn.Write([]byte(strconv.Ftoa32(float32(p), 'f', 4)))
-        },
-        StopCh: stopCh}
-
-    // get vector
-    var ringVector *RingVector
-    if len(input.VectorName) == 0 {
-        vectorParams := RingVectorParameters{
-            Radius:    input.VectorRadius,
-            Count:     input.VectorRings,
-            RadiusInc: input.RingSizeInc}
-
-        ringVector = NewRingVector(vectorParams)
-        ringVector.LoadData(rgbaInput, input.VecX, input.VecY)
-    } else {
-        // load vector from file
-        vectorFile, err := os.OpenFile(VectorDir+input.VectorName, os.O_RDONLY, 0666)
+    rgbaInput := sivq.ConvertRGBA(inputImage)
+
+    border, err := sivq.ParseBorderMode(input.Border)
+    if err != nil {
+        return err
+    }
+    metric, err := sivq.ParseMetric(input.Metric)
+    if err != nil {
+        return err
+    }
+    scales, err := sivq.ParseScales(input.Scales)
+    if err != nil {
+        return err
+    }
+    thresholdMethod, err := sivq.ParseThresholdMethod(input.ThresholdMethod)
+    if err != nil {
+        return err
+    }
+    colormap, err := sivq.ParseColormap(input.Colormap)
+    if err != nil {
+        return err
+    }
+    low, high, err := sivq.ParseRange(input.Range)
+    if err != nil {
+        return err
+    }
+    rects, err := sivq.ParseRects(input.ROI)
+    if err != nil {
+        return err
+    }
+
+    sivqParams := sivq.SIVQParameters{
+        GammaAdjustment:     sivq.Float(input.GammaAdjust),
+        AverageBias:         sivq.Float(input.AverageBias),
+        RotationStride:      sivq.Float(input.RotationStride),
+        ExactRotation:       input.ExactRotation,
+        Mirror:              input.Mirror,
+        Scales:              scales,
+        Orientation:         input.Orientation || input.Detect,
+        Metric:              metric,
+        MatchingStride:      input.MatchStride,
+        MatchingOffset:      input.MatchingOffset,
+        TopK:                input.TopK,
+        Threshold:           sivq.Float(input.Threshold),
+        ThresholdMethod:     thresholdMethod,
+        ThresholdPercentile: sivq.Float(input.ThresholdPercentile),
+        Workers:             *workers,
+        ChunkRows:           *chunkRows,
+        Border:              border,
+        BorderValue:         sivq.Float(input.BorderValue),
+        ProgressCallback: func(p sivq.Progress) {
+            conn.Write([]byte(strconv.Ftoa32(float32(p.Fraction()), 'f', 4)))
+        }}
+
+    // only compare the selected rectangles and tissue
+    b := rgbaInput.Bounds()
+    if len(rects) > 0 {
+        sivqParams.Mask = sivq.RectMask(b.Dx(), b.Dy(), rects)
+    }
+    if input.Tissue {
+        mask := sivq.TissueMask(rgbaInput, TissueClose)
+        if sivqParams.Mask != nil {
+            mask = mask.Intersected(sivqParams.Mask)
+        }
+        sivqParams.Mask = mask
+    }
+
+    var result *sivq.Result
+    labels := 0 // number of vectors labelled with, 0 for a single vector
+    radius := 0
+    if names := strings.Fields(strings.Replace(input.LabelVectors, ",", " ", -1)); len(names) > 0 {
+        // label with several saved vectors
+        vectors := make([]*sivq.RingVector, len(names))
+        for i, name := range names {
+            if vectors[i], err = loadVector(name); err != nil {
+                return err
+            }
+            if vectors[i].MaxRadius > radius {
+                radius = vectors[i].MaxRadius
+            }
+        }
+        result, err = sivq.RunVectors(ctx, sivqParams, rgbaInput, vectors)
         if err != nil {
             return err
         }
-        defer vectorFile.Close()
+        labels = len(vectors)
+    } else {
+        // get vector
+        var ringVector *sivq.RingVector
+        if len(input.VectorName) == 0 {
+            weights, err := sivq.ParseWeights(input.Weights)
+            if err != nil {
+                return err
+            }
+            vectorParams := sivq.RingVectorParameters{
+                Radius:     input.VectorRadius,
+                Count:      input.VectorRings,
+                RadiusInc:  input.RingSizeInc,
+                ColorSpace: input.ColorSpace,
+                Weights:    weights,
+                Sampler:    input.Sampler,
+                Samples:    input.Samples}
+
+            ringVector = sivq.NewRingVector(vectorParams)
+            ringVector.LoadData(rgbaInput, input.VecX, input.VecY)
+        } else {
+            // load vector from file
+            ringVector, err = loadVector(input.VectorName)
+            if err != nil {
+                return err
+            }
+        }
+        radius = ringVector.MaxRadius
 
-        decoder := gob.NewDecoder(vectorFile)
-        err = decoder.Decode(&ringVector)
+        // do the magic
+        result, err = sivq.RunResult(ctx, sivqParams, rgbaInput, ringVector)
         if err != nil {
             return err
         }
     }
 
-    // do the magic
-    outputImage := SIVQ(sivqParams, rgbaInput, ringVector)
+    threshold, err := sivqParams.OutputThreshold(result.Distance)
+    if err != nil {
+        return err
+    }
+    if thresholdMethod != sivq.ThresholdManual {
+        // report the chosen threshold back
+        jsonResponse, _ := json.MarshalForHTML(&ThresholdResult{Threshold: float64(threshold),
+            Message: thresholdMethod.String() + " threshold"})
+        conn.Write(jsonResponse)
+    }
+    if input.Detect {
+        err = sendDetections(conn, input, result, sivq.DistanceThreshold(sivqParams.GammaAdjustment, threshold), radius)
+        if err != nil {
+            return err
+        }
+    }
+    if input.Contours {
+        err = sendContours(conn, input, result.Distance, sivq.DistanceThreshold(sivqParams.GammaAdjustment, threshold))
+        if err != nil {
+            return err
+        }
+    }
+    outputImage := result.Distance.ToRGBA(sivqParams.GammaAdjustment, threshold)
+    if labels > 0 {
+        outputImage = result.LabelRGBA(labels, sivqParams.GammaAdjustment)
+        if err = sendTopLabels(conn, input, result, labels, sivqParams.GammaAdjustment); err != nil {
+            return err
+        }
+    }
+    if input.Colormap != "" || input.Range != "" || input.Overlay > 0 {
+        outputImage = result.Distance.Heatmap(sivq.HeatmapParameters{
+            Colormap:  colormap,
+            Gamma:     sivqParams.GammaAdjustment,
+            Low:       low,
+            High:      high,
+            Threshold: threshold})
+        if input.Overlay > 0 {
+            outputImage = sivq.Overlay(rgbaInput, outputImage, sivq.Float(input.Overlay))
+        }
+    }
+    if input.Orientation {
+        outputImage = result.OrientationRGBA(sivqParams.GammaAdjustment)
+    }
 
     if err = png.Encode(outputFile, outputImage); err != nil {
         return err
@@ -339,6 +540,114 @@ func process(input *ProcessInput, conn *websocket.Conn, stopCh chan bool) os.Err
     return nil
 }
 
+/*
+ * Save the label maps of the second best vectors and below and send the
+ * links to the client
+ */
+func sendTopLabels(conn *websocket.Conn, input *ProcessInput, result *sivq.Result, labels int, gamma sivq.Float) os.Error {
+    if len(result.TopLabels) < 2 {
+        return nil
+    }
+    links := make([]string, len(result.TopLabels)-1)
+    for i := range links {
+        top := &sivq.Result{Distance: result.TopDistances[i+1], Label: result.TopLabels[i+1]}
+        name := fmt.Sprintf("%s%s.top%d.png", ResultDir, input.Image, i+2)
+        topFile, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+        if err != nil {
+            return err
+        }
+        err = png.Encode(topFile, top.LabelRGBA(labels, gamma))
+        topFile.Close()
+        if err != nil {
+            return err
+        }
+        links[i] = "/" + name
+    }
+
+    jsonResponse, _ := json.MarshalForHTML(&TopResult{Top: links,
+        Message: strconv.Itoa(len(links)) + " next best label maps"})
+    conn.Write(jsonResponse)
+    return nil
+}
+
+/*
+ * Save the detections of a result and send them to the client
+ */
+func sendDetections(conn *websocket.Conn, input *ProcessInput, result *sivq.Result, threshold sivq.Float, radius int) os.Error {
+    detections := result.Detect(threshold, radius)
+    name := ResultDir + input.Image + ".detections"
+
+    csvFile, err := os.OpenFile(name+".csv", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+    if err != nil {
+        return err
+    }
+    defer csvFile.Close()
+    if err = sivq.WriteDetectionsCSV(csvFile, detections); err != nil {
+        return err
+    }
+    jsonData, err := json.Marshal(detections)
+    if err != nil {
+        return err
+    }
+    if err = ioutil.WriteFile(name+".json", jsonData, 0666); err != nil {
+        return err
+    }
+
+    jsonResponse, _ := json.MarshalForHTML(&DetectionResult{Detections: detections, CSV: "/" + name + ".csv",
+        JSON: "/" + name + ".json", Message: strconv.Itoa(len(detections)) + " detections"})
+    conn.Write(jsonResponse)
+    return nil
+}
+
+/*
+ * Save the contours of the matches as GeoJSON and as SVG over the uploaded
+ * image and send the links to the client
+ */
+func sendContours(conn *websocket.Conn, input *ProcessInput, distances *sivq.FloatGray, threshold sivq.Float) os.Error {
+    polygons := distances.Contours(threshold, sivq.Float(input.Simplify))
+    name := ResultDir + input.Image + ".contours"
+
+    geoJSONFile, err := os.OpenFile(name+".geojson", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+    if err != nil {
+        return err
+    }
+    defer geoJSONFile.Close()
+    if err = sivq.WriteGeoJSON(geoJSONFile, polygons); err != nil {
+        return err
+    }
+    svgFile, err := os.OpenFile(name+".svg", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+    if err != nil {
+        return err
+    }
+    defer svgFile.Close()
+    b := distances.Bounds()
+    if err = sivq.WriteSVG(svgFile, polygons, "/"+UploadDir+input.Image, b.Dx(), b.Dy()); err != nil {
+        return err
+    }
+
+    jsonResponse, _ := json.MarshalForHTML(&ContourResult{Contours: len(polygons), GeoJSON: "/" + name + ".geojson",
+        SVG: "/" + name + ".svg", Message: strconv.Itoa(len(polygons)) + " contours"})
+    conn.Write(jsonResponse)
+    return nil
+}
+
+/*
+ * Load a saved vector
+ */
+func loadVector(name string) (*sivq.RingVector, os.Error) {
+    vectorFile, err := os.OpenFile(VectorDir+name, os.O_RDONLY, 0666)
+    if err != nil {
+        return nil, err
+    }
+    defer vectorFile.Close()
+
+    var ringVector *sivq.RingVector
+    if err = gob.NewDecoder(vectorFile).Decode(&ringVector); err != nil {
+        return nil, err
+    }
+    return ringVector, nil
+}
+
 /*
  * Create vector and save to file
  */
@@ -355,6 +664,16 @@ func saveVectorHandler(w http.ResponseWriter, r *http.Request) {
     checkError(err)
     vecY, err := strconv.Atoi(r.FormValue("vecY"))
     checkError(err)
+    colorSpace := r.FormValue("colorSpace")
+    _, err = sivq.ParseColorSpace(colorSpace)
+    checkError(err)
+    weights, err := sivq.ParseWeights(r.FormValue("weights"))
+    checkError(err)
+    sampler := r.FormValue("sampler")
+    samples, err := strconv.Atoi(r.FormValue("samples"))
+    checkError(err)
+    _, err = sivq.ParseSampler(sampler, samples)
+    checkError(err)
 
     // open input file
     inputFile, err := os.OpenFile(UploadDir+imageName, os.O_RDONLY, 0666)
@@ -369,14 +688,18 @@ func saveVectorHandler(w http.ResponseWriter, r *http.Request) {
     // decode png image
     inputImage, _, err := image.Decode(inputFile)
     checkError(err)
-    rgbaInput := rgba(inputImage)
+    rgbaInput := sivq.ConvertRGBA(inputImage)
 
     // create vector
-    vectorParams := RingVectorParameters{
-        Radius:    radius,
-        Count:     vectorRings,
-        RadiusInc: ringSizeInc}
-    ringVector := NewRingVector(vectorParams)
+    vectorParams := sivq.RingVectorParameters{
+        Radius:     radius,
+        Count:      vectorRings,
+        RadiusInc:  ringSizeInc,
+        ColorSpace: colorSpace,
+        Weights:    weights,
+        Sampler:    sampler,
+        Samples:    samples}
+    ringVector := sivq.NewRingVector(vectorParams)
     ringVector.LoadData(rgbaInput, vecX, vecY)
 
     // save into file
@@ -387,3 +710,65 @@ func saveVectorHandler(w http.ResponseWriter, r *http.Request) {
     jsonResponse, _ := json.MarshalForHTML(&UploadResult{Image: vectorName, Error: false, Message: "Saved."})
     fmt.Fprint(w, string(jsonResponse))
 }
+
+/*
+ * Search parameters separating positive from negative points
+ */
+func optimizeHandler(w http.ResponseWriter, r *http.Request) {
+    imageName := r.FormValue("image")
+    vecX, err := strconv.Atoi(r.FormValue("vecX"))
+    checkError(err)
+    vecY, err := strconv.Atoi(r.FormValue("vecY"))
+    checkError(err)
+    positives, err := sivq.ParsePoints(r.FormValue("positives"))
+    checkError(err)
+    negatives, err := sivq.ParsePoints(r.FormValue("negatives"))
+    checkError(err)
+    colorSpace := r.FormValue("colorSpace")
+    _, err = sivq.ParseColorSpace(colorSpace)
+    checkError(err)
+    weights, err := sivq.ParseWeights(r.FormValue("weights"))
+    checkError(err)
+    sampler := r.FormValue("sampler")
+    samples, err := strconv.Atoi(r.FormValue("samples"))
+    checkError(err)
+    matchingOffset, err := strconv.Atoi(r.FormValue("matchingOffset"))
+    checkError(err)
+
+    // open input file
+    inputFile, err := os.OpenFile(UploadDir+imageName, os.O_RDONLY, 0666)
+    checkError(err)
+    defer inputFile.Close()
+
+    // decode png image
+    inputImage, _, err := image.Decode(inputFile)
+    checkError(err)
+    rgbaInput := sivq.ConvertRGBA(inputImage)
+
+    // search parameters around the vector
+    vectorParams := sivq.RingVectorParameters{
+        ColorSpace: colorSpace,
+        Weights:    weights,
+        Sampler:    sampler,
+        Samples:    samples}
+    sivqParams := sivq.SIVQParameters{
+        ExactRotation:  r.FormValue("exactRotation") == "true",
+        Mirror:         r.FormValue("mirror") == "true",
+        MatchingOffset: matchingOffset,
+        Workers:        *workers}
+    best, err := sivq.Optimize(sivq.Background(), rgbaInput, vectorParams, sivqParams, image.Point{vecX, vecY},
+        positives, negatives, sivq.DefaultSearchSpace)
+    checkError(err)
+
+    jsonResponse, _ := json.MarshalForHTML(&OptimizeResult{
+        VectorRadius:   best.Vector.Radius,
+        VectorRings:    best.Vector.Count,
+        RingSizeInc:    best.Vector.RadiusInc,
+        Metric:         best.Params.Metric.Name(),
+        MatchStride:    best.Params.MatchingStride,
+        RotationStride: float64(best.Params.RotationStride),
+        Score:          float64(best.Score),
+        Margin:         float64(best.Margin),
+        Message:        "Optimized."})
+    fmt.Fprint(w, string(jsonResponse))
+}
@@ -18,6 +18,7 @@ var main = {
     buttonStop: null,
     buttonSIVQ: null,
     buttonAdjustParameters: null,
+    buttonOptimize: null,
     inputNewVectorName: null,
     buttonSaveNewVector: null,
     selectVector: null,
@@ -209,6 +210,10 @@ var main = {
         	e.stopPropagation();
         	process.process(true);
         });
+        main.buttonOptimize = $("#optimize").click(function(e) {
+            process.optimize();
+            return false;
+        });
         main.inputNewVectorName = $("#newVectorName");
         main.buttonSaveNewVector = $("#saveNewVector").click(function(e) {
             process.saveVector();
@@ -12,6 +12,8 @@ var process = {
 
 	input: {},
 
+	resultLinks: "",
+
 	tryParameters: [],
 	tryValues: [],
 
@@ -62,22 +64,45 @@ var process = {
 		var input = {
 			image: main.inputImageName.val(),
 			vectorName: $.trim(main.selectVector.val()),
+			labelVectors: ($("#labelVectors").val() || []).join(","),
+			topK: parseInt($("#topK").val()),
 			vecX: parseInt(main.inputX.val()),
 			vecY: parseInt(main.inputY.val()),
 			vectorRadius: parseInt(main.inputVectorRadius.val()),
 			vectorRings: parseInt($("#vectorRings").val()),
 			ringSizeInc: parseInt($("#ringSizeInc").val()),
 			threshold: parseFloat($("#threshold").val()),
+			thresholdMethod: $("#thresholdMethod").val(),
+			thresholdPercentile: parseFloat($("#thresholdPercentile").val()),
 			rotationStride: parseFloat($("#rotationStride").val()),
+			exactRotation: $("#exactRotation").is(":checked"),
+			mirror: $("#mirror").is(":checked"),
+			orientation: $("#orientation").is(":checked"),
+			colormap: $("#colormap").val(),
+			range: $.trim($("#range").val()),
+			overlay: parseFloat($("#overlay").val()),
+			roi: $.trim($("#roi").val()),
+			tissue: $("#tissue").is(":checked"),
+			detect: $("#detect").is(":checked"),
+			contours: $("#contours").is(":checked"),
+			simplify: parseFloat($("#simplify").val()),
+			scales: $.trim($("#scales").val()),
+			metric: $("#metric").val(),
+			colorSpace: $("#colorSpace").val(),
+			weights: $.trim($("#weights").val()),
+			sampler: $("#sampler").val(),
+			samples: parseInt($("#samples").val()),
 			matchStride: parseInt($("#matchStride").val()),
 			matchingOffset: parseInt($("#matchingOffset").val()),
 			gammaAdjust: parseFloat($("#gammaAdjust").val()),
-			averageBias: parseFloat($("#averageBias").val())
+			averageBias: parseFloat($("#averageBias").val()),
+			border: $("#border").val(),
+			borderValue: parseFloat($("#borderValue").val())
 		};
 
 		// remove NaNs
 		for (i in input) {
-			if (isNaN(input[i]) && i != "vectorName" && i != "image") {
+			if (typeof input[i] == "number" && isNaN(input[i])) {
 				input[i] = -1;
 			}
 		}
@@ -102,7 +127,8 @@ var process = {
 		}
 
 		var input = process.getInput();
-		if (((input.vecX < 0 || input.vecY < 0 || input.vectorRadius <= 0 || input.vectorRings <= 0 || input.ringSizeInc < 0) && input.vectorName.length == 0)
+		if (((input.vecX < 0 || input.vecY < 0 || input.vectorRadius <= 0 || input.vectorRings <= 0 || input.ringSizeInc < 0)
+				&& input.vectorName.length == 0 && input.labelVectors.length == 0)
 				|| input.image.length == 0) {
 			main.showError("Please fill in all fields.");
 			return;
@@ -139,6 +165,7 @@ var process = {
 	
 	advancedProcess: function() {
 		main.divResult.html('<div class="loader"></div>');
+		process.resultLinks = "";
 
 		// send image for processing
 		process.connection.send(JSON.stringify(process.input));
@@ -255,8 +282,22 @@ var process = {
 	serverMessage: function(e) {
 		var data = e.data;
 		if (data.substr(0, 1) == "{") {
-			// error message
 			data = JSON.parse(data);
+			if (!data.Error) {
+				if (data.Detections !== undefined) {
+					process.showDetections(data);
+				} else if (data.Contours !== undefined) {
+					process.resultLinks += '<p>'+ data.Message +': <a href="'+ data.GeoJSON +'">GeoJSON</a> <a href="'+ data.SVG +'">SVG</a></p>';
+				} else if (data.Top !== undefined) {
+					process.showTopLabels(data);
+				} else {
+					// automatically chosen threshold
+					$("#threshold").val(data.Threshold.toFixed(4));
+				}
+				return;
+			}
+
+			// error message
 			main.showError(data.Message);
 			main.divResult.html(data.Message);
 		} else if (data.length > 6) {
@@ -267,7 +308,7 @@ var process = {
 				return;
 			}
 
-			main.divResult.html('<img src="data:image/png;base64,'+ data +'" alt="" />');
+			main.divResult.html('<img src="data:image/png;base64,'+ data +'" alt="" />' + process.resultLinks);
 			process.closeConnection();
 		} else {
 			// loader status
@@ -275,6 +316,33 @@ var process = {
 		}
 	},
 
+	/*
+	 * Mark detections on original image
+	 */
+	showDetections: function(data) {
+		var detections = data.Detections || [];
+		var ctx = main.canvasOriginal.getContext("2d");
+		ctx.strokeStyle = "red";
+		for (var i = 0; i < detections.length; i++) {
+			ctx.beginPath();
+			ctx.arc(detections[i].X, detections[i].Y, 3, 0, Math.PI*2, false);
+			ctx.closePath();
+			ctx.stroke();
+		}
+		process.resultLinks += '<p>'+ data.Message +': <a href="'+ data.CSV +'">CSV</a> <a href="'+ data.JSON +'">JSON</a></p>';
+	},
+
+	/*
+	 * Link the label maps of the next best vectors
+	 */
+	showTopLabels: function(data) {
+		var links = [];
+		for (var i = 0; i < data.Top.length; i++) {
+			links.push('<a href="'+ data.Top[i] +'">'+ (i + 2) +'</a>');
+		}
+		process.resultLinks += '<p>'+ data.Message +': '+ links.join(" ") +'</p>';
+	},
+
 	/*
 	 * Stop processing image
 	 */
@@ -303,6 +371,40 @@ var process = {
 		} catch(e) {}
 	},
 	
+	/*
+	 * Search parameters separating positive from negative points
+	 */
+	optimize: function() {
+		var input = process.getInput();
+		input.positives = $.trim($("#positives").val());
+		input.negatives = $.trim($("#negatives").val());
+
+		if (input.vecX < 0 || input.vecY < 0 || input.image.length == 0
+				|| input.positives.length == 0 || input.negatives.length == 0) {
+			main.showError("Please select vector and fill in positive and negative points (x:y, ...).");
+			return;
+		}
+
+		main.buttonOptimize.attr("disabled", "disabled");
+		main.divResult.html('<div class="loader"></div>');
+		$.post("/optimize", input, function(response) {
+			main.buttonOptimize.removeAttr("disabled");
+			if (response.Error) {
+				main.showError(response.Message);
+				main.divResult.html(response.Message);
+				return;
+			}
+			main.inputVectorRadius.val(response.VectorRadius);
+			$("#vectorRings").val(response.VectorRings);
+			$("#ringSizeInc").val(response.RingSizeInc);
+			$("#metric").val(response.Metric);
+			$("#matchStride").val(response.MatchStride);
+			$("#rotationStride").val(response.RotationStride);
+			main.drawVector();
+			main.divResult.html("Separation score "+ response.Score.toFixed(4) +", margin "+ response.Margin.toFixed(4) +".");
+		}, "json");
+	},
+
 	/*
 	 * Save vector into file
 	 */